@@ -0,0 +1,130 @@
+package sqlagent
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ObjectRef is a single table or column referenced by an analyzed
+// statement, classified as "read" or "write" by the clause it appeared in.
+type ObjectRef struct {
+	Name string `json:"name"`
+	Mode string `json:"mode"`
+}
+
+// AnalysisResult is the output of Analyze: every table, column, and
+// function reference found in a statement, each with a best-effort
+// read/write classification.
+type AnalysisResult struct {
+	Tables    []ObjectRef `json:"tables"`
+	Columns   []ObjectRef `json:"columns"`
+	Functions []string    `json:"functions"`
+}
+
+var (
+	analyzeFrom       = regexp.MustCompile(`(?i)\bfrom\s+([a-zA-Z_][\w.]*)`)
+	analyzeJoin       = regexp.MustCompile(`(?i)\bjoin\s+([a-zA-Z_][\w.]*)`)
+	analyzeUpdate     = regexp.MustCompile(`(?i)\bupdate\s+([a-zA-Z_][\w.]*)`)
+	analyzeInsertInto = regexp.MustCompile(`(?i)\binsert\s+into\s+([a-zA-Z_][\w.]*)`)
+	analyzeDeleteFrom = regexp.MustCompile(`(?i)\bdelete\s+from\s+([a-zA-Z_][\w.]*)`)
+
+	analyzeSelectList  = regexp.MustCompile(`(?is)\bselect\b(.*?)\bfrom\b`)
+	analyzeSetClause   = regexp.MustCompile(`(?is)\bset\b(.*?)(?:\bwhere\b|$)`)
+	analyzeWhereClause = regexp.MustCompile(`(?is)\bwhere\b(.*?)(?:\b(?:group by|order by|having|limit)\b|$)`)
+
+	analyzeFuncCall = regexp.MustCompile(`(?i)\b([a-zA-Z_][\w]*)\s*\(`)
+	analyzeColumn   = regexp.MustCompile(`(?i)\b([a-zA-Z_][\w]*(?:\.[a-zA-Z_][\w]*)?)\b`)
+)
+
+// analyzeKeywords excludes SQL keywords and the functions/columns regexes
+// would otherwise pick up as column or function names.
+var analyzeKeywords = map[string]bool{
+	"select": true, "from": true, "where": true, "and": true, "or": true,
+	"not": true, "in": true, "is": true, "null": true, "as": true,
+	"distinct": true, "case": true, "when": true, "then": true, "else": true,
+	"end": true, "asc": true, "desc": true, "between": true, "like": true,
+	"group": true, "order": true, "by": true, "having": true, "limit": true,
+	"on": true, "all": true, "exists": true,
+}
+
+// Analyze runs a lightweight, heuristic pass over sql to identify the
+// tables, columns, and functions it references, classifying each table and
+// column as "read" or "write" based on the clause it appeared in (FROM/JOIN
+// and SELECT/WHERE are reads; UPDATE, INSERT INTO, DELETE FROM, and SET are
+// writes). Like Lint, it does not parse SQL: it's a regex-based best effort
+// meant to work across every dialect this agent supports, not a
+// dialect-aware parser, so it can both miss references and misclassify
+// edge cases (subqueries, CTEs, and dialect-specific syntax in particular).
+func Analyze(sql string) AnalysisResult {
+	var result AnalysisResult
+
+	seenTables := make(map[string]bool)
+	addTable := func(name, mode string) {
+		key := mode + ":" + name
+		if seenTables[key] {
+			return
+		}
+		seenTables[key] = true
+		result.Tables = append(result.Tables, ObjectRef{Name: name, Mode: mode})
+	}
+
+	for _, m := range analyzeFrom.FindAllStringSubmatch(sql, -1) {
+		addTable(m[1], "read")
+	}
+	for _, m := range analyzeJoin.FindAllStringSubmatch(sql, -1) {
+		addTable(m[1], "read")
+	}
+	for _, m := range analyzeUpdate.FindAllStringSubmatch(sql, -1) {
+		addTable(m[1], "write")
+	}
+	for _, m := range analyzeInsertInto.FindAllStringSubmatch(sql, -1) {
+		addTable(m[1], "write")
+	}
+	for _, m := range analyzeDeleteFrom.FindAllStringSubmatch(sql, -1) {
+		addTable(m[1], "write")
+	}
+
+	seenColumns := make(map[string]bool)
+	addColumn := func(name, mode string) {
+		if analyzeKeywords[strings.ToLower(name)] {
+			return
+		}
+		key := mode + ":" + name
+		if seenColumns[key] {
+			return
+		}
+		seenColumns[key] = true
+		result.Columns = append(result.Columns, ObjectRef{Name: name, Mode: mode})
+	}
+
+	if m := analyzeSelectList.FindStringSubmatch(sql); m != nil {
+		for _, c := range analyzeColumn.FindAllString(m[1], -1) {
+			addColumn(c, "read")
+		}
+	}
+	if m := analyzeWhereClause.FindStringSubmatch(sql); m != nil {
+		for _, c := range analyzeColumn.FindAllString(m[1], -1) {
+			addColumn(c, "read")
+		}
+	}
+	if m := analyzeSetClause.FindStringSubmatch(sql); m != nil {
+		for _, c := range analyzeColumn.FindAllString(m[1], -1) {
+			addColumn(c, "write")
+		}
+	}
+
+	seenFuncs := make(map[string]bool)
+	for _, m := range analyzeFuncCall.FindAllStringSubmatch(sql, -1) {
+		name := m[1]
+		if analyzeKeywords[strings.ToLower(name)] {
+			continue
+		}
+		if seenFuncs[strings.ToLower(name)] {
+			continue
+		}
+		seenFuncs[strings.ToLower(name)] = true
+		result.Functions = append(result.Functions, name)
+	}
+
+	return result
+}
@@ -0,0 +1,140 @@
+package sqlagent
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// BatchStatement is a single write statement within an ExecBatch run.
+type BatchStatement struct {
+	SQL    string
+	Params map[string]interface{}
+}
+
+// BatchResult reports the outcome of one statement within an ExecBatch run.
+// Error is empty for statements that ran successfully.
+type BatchResult struct {
+	RowsAffected int64
+	Error        string
+}
+
+// savepointStatements builds the SAVEPOINT/ROLLBACK TO/RELEASE statements
+// for driver. MSSQL uses its own transaction-marking syntax instead of the
+// ANSI SAVEPOINT keyword the other supported drivers accept, and has no
+// equivalent to RELEASE SAVEPOINT.
+func savepointStatements(driver, name string) (save, rollback, release string) {
+	if driver == "mssql" {
+		return fmt.Sprintf("SAVE TRANSACTION %s", name),
+			fmt.Sprintf("ROLLBACK TRANSACTION %s", name),
+			""
+	}
+
+	return fmt.Sprintf("SAVEPOINT %s", name),
+		fmt.Sprintf("ROLLBACK TO SAVEPOINT %s", name),
+		fmt.Sprintf("RELEASE SAVEPOINT %s", name)
+}
+
+// ExecBatch runs statements inside a single transaction on db. ctx bounds
+// the whole batch, the same deadline-propagation-into-the-driver approach
+// ExecuteProfile uses for a single statement, so a batch honoring a
+// profile's timeout aborts the in-flight statement instead of leaving the
+// driver to run it to completion after the caller has given up.
+//
+// By default it is all-or-nothing: the first statement to fail rolls back
+// the whole transaction and the error is returned alongside the results for
+// the statements that ran before it. When tolerant is true, each statement
+// runs inside its own savepoint instead; a failing statement is rolled back
+// to its savepoint (discarding only its own effect) and the batch
+// continues, so one bad statement in a migration script does not sink the
+// ones before and after it.
+func ExecBatch(ctx context.Context, db *sqlx.DB, driver string, statements []BatchStatement, tolerant bool) ([]BatchResult, error) {
+	// The vendored sqlx predates sqlx.Tx's own context-aware methods, so
+	// the transaction is begun via the embedded *sql.DB's BeginTx (same
+	// reasoning as namedQueryContext in execcontext.go) and each statement
+	// is bound by hand with db.BindNamed before running it through the
+	// plain *sql.Tx.
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, 0, len(statements))
+
+	for i, stmt := range statements {
+		if !tolerant {
+			n, err := execBatchStatement(ctx, db, tx, stmt)
+			if err != nil {
+				tx.Rollback()
+				return results, err
+			}
+
+			results = append(results, BatchResult{RowsAffected: n})
+			continue
+		}
+
+		save, rollback, release := savepointStatements(driver, fmt.Sprintf("sqlagent_%d", i))
+
+		if _, err := tx.ExecContext(ctx, save); err != nil {
+			tx.Rollback()
+			return results, err
+		}
+
+		n, execErr := execBatchStatement(ctx, db, tx, stmt)
+		if execErr != nil {
+			if _, err := tx.ExecContext(ctx, rollback); err != nil {
+				tx.Rollback()
+				return results, err
+			}
+
+			results = append(results, BatchResult{Error: execErr.Error()})
+			continue
+		}
+
+		if release != "" {
+			if _, err := tx.ExecContext(ctx, release); err != nil {
+				tx.Rollback()
+				return results, err
+			}
+		}
+
+		results = append(results, BatchResult{RowsAffected: n})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return results, err
+	}
+
+	return results, nil
+}
+
+func execBatchStatement(ctx context.Context, db *sqlx.DB, tx *sql.Tx, stmt BatchStatement) (int64, error) {
+	var (
+		result sql.Result
+		err    error
+	)
+
+	if stmt.Params != nil && len(stmt.Params) > 0 {
+		params, terr := resolveTypedParams(stmt.Params)
+		if terr != nil {
+			return 0, terr
+		}
+
+		q, args, berr := db.BindNamed(stmt.SQL, params)
+		if berr != nil {
+			return 0, berr
+		}
+
+		result, err = tx.ExecContext(ctx, q, args...)
+	} else {
+		result, err = tx.ExecContext(ctx, stmt.SQL)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,130 @@
+package sqlagent
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// ShadowConfig configures canary/shadow execution for a Profile: a sample
+// of requests run against it are also executed against a second backend
+// (e.g. a database being migrated to) so the two can be compared without
+// any client-visible change, for migration validation.
+type ShadowConfig struct {
+	Driver     string
+	Connection map[string]interface{}
+
+	// SampleRate is the fraction of requests, in [0, 1], that also run
+	// against the shadow backend. Zero disables shadowing.
+	SampleRate float64
+
+	// Timeout bounds the shadow query independently of the primary
+	// profile's own timeout, since a struggling shadow backend (often the
+	// whole reason to shadow it) must never be allowed to outlast the
+	// primary request it's shadowing.
+	Timeout time.Duration
+}
+
+// ShadowResult summarizes one execution for comparison against the other
+// side of a shadow pair.
+type ShadowResult struct {
+	Rows     int
+	Err      error
+	Duration time.Duration
+}
+
+// ShadowComparison is passed to ShadowObserver once a shadow execution
+// completes.
+type ShadowComparison struct {
+	Profile string
+
+	Primary ShadowResult
+	Shadow  ShadowResult
+
+	// Compared is true when a primary result was available to compare
+	// against, making RowCountMatch meaningful. It's false for a streamed
+	// primary response, whose rows are never held in memory at once to
+	// compare; those are still shadowed, but only for shadow-backend error
+	// detection, not row-count comparison.
+	Compared      bool
+	RowCountMatch bool
+}
+
+// ShadowObserver, when set, is notified after every shadow execution
+// completes. It mirrors the RouteObserver and Logger.Log hook pattern: the
+// root package has no metrics dependency of its own, so a host binary
+// wires this to whatever it uses (expvar, a metrics client, alerting).
+var ShadowObserver func(ShadowComparison)
+
+// ShouldShadow reports whether a request against a profile configured
+// with cfg should also be shadowed, sampling at cfg.SampleRate. A nil cfg
+// or a non-positive SampleRate never shadows.
+func ShouldShadow(cfg *ShadowConfig) bool {
+	if cfg == nil || cfg.SampleRate <= 0 {
+		return false
+	}
+
+	if cfg.SampleRate >= 1 {
+		return true
+	}
+
+	return rand.Float64() < cfg.SampleRate
+}
+
+// RunShadow executes sql/params against cfg's shadow backend in the
+// background and reports the outcome to ShadowObserver, compared against
+// primary when compared is true. It never blocks the caller and never
+// surfaces an error to it: a broken shadow backend must never affect the
+// primary request it shadows.
+func RunShadow(profileName string, cfg *ShadowConfig, sql string, params map[string]interface{}, primary ShadowResult, compared bool) {
+	if cfg == nil {
+		return
+	}
+
+	go func() {
+		start := time.Now()
+
+		db, err := PersistentConnect(cfg.Driver, cfg.Connection)
+		if err != nil {
+			reportShadow(profileName, primary, ShadowResult{Err: err}, compared)
+			return
+		}
+
+		ctx := context.Background()
+
+		if cfg.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+			defer cancel()
+		}
+
+		iter, err := Execute(ctx, db, sql, params)
+		if err != nil {
+			reportShadow(profileName, primary, ShadowResult{Err: err, Duration: time.Since(start)}, compared)
+			return
+		}
+		defer iter.Close()
+
+		shadow := ShadowResult{}
+		for iter.Next() {
+			shadow.Rows++
+		}
+		shadow.Duration = time.Since(start)
+
+		reportShadow(profileName, primary, shadow, compared)
+	}()
+}
+
+func reportShadow(profileName string, primary, shadow ShadowResult, compared bool) {
+	if ShadowObserver == nil {
+		return
+	}
+
+	ShadowObserver(ShadowComparison{
+		Profile:       profileName,
+		Primary:       primary,
+		Shadow:        shadow,
+		Compared:      compared,
+		RowCountMatch: compared && shadow.Err == nil && primary.Rows == shadow.Rows,
+	})
+}
@@ -0,0 +1,78 @@
+package sqlagent
+
+// Capabilities describes what a registered driver supports, so generic
+// clients can adapt behavior (batching, pagination, auth) per backend
+// automatically instead of hard-coding it per driver name.
+type Capabilities struct {
+	// Placeholder is the bound-parameter style used in SQL text for this
+	// driver, copied from its Dialect: "named" (:name), "positional" (?),
+	// or "numbered" ($1).
+	Placeholder string
+
+	// Transactions reports whether BEGIN/COMMIT/ROLLBACK, and so
+	// ExecBatch's all-or-nothing mode, are supported.
+	Transactions bool
+
+	// Savepoints reports whether ExecBatch's tolerant mode (partial commit
+	// via savepoints) is supported.
+	Savepoints bool
+
+	// MultipleResultSets reports whether a single query can return more
+	// than one result set.
+	MultipleResultSets bool
+
+	// Streaming reports whether rows can be read incrementally instead of
+	// requiring the full result set to be materialized first.
+	Streaming bool
+
+	// AuthModes lists the connection-parameter authentication modes this
+	// driver accepts.
+	AuthModes []string
+
+	// Introspection reports whether the backend exposes a queryable
+	// catalog (e.g. information_schema) for schema discovery.
+	Introspection bool
+}
+
+// capabilities maps each internal driver name to its Capabilities. Only
+// drivers with a registered Dialect are covered, the same set
+// GetCapabilities, QuoteIdentifier, and QuoteLiteral share.
+var capabilities = map[string]Capabilities{
+	"postgres": {
+		Transactions: true, Savepoints: true, MultipleResultSets: false, Streaming: true,
+		AuthModes: []string{"password", "iam"}, Introspection: true,
+	},
+	"mysql": {
+		Transactions: true, Savepoints: true, MultipleResultSets: true, Streaming: true,
+		AuthModes: []string{"password"}, Introspection: true,
+	},
+	"sqlite3": {
+		Transactions: true, Savepoints: true, MultipleResultSets: false, Streaming: true,
+		AuthModes: []string{"none"}, Introspection: true,
+	},
+	"mssql": {
+		Transactions: true, Savepoints: true, MultipleResultSets: true, Streaming: true,
+		AuthModes: []string{"password", "windows"}, Introspection: true,
+	},
+	"oci8": {
+		Transactions: true, Savepoints: true, MultipleResultSets: false, Streaming: true,
+		AuthModes: []string{"password", "wallet"}, Introspection: true,
+	},
+	"snowflake": {
+		Transactions: true, Savepoints: false, MultipleResultSets: false, Streaming: true,
+		AuthModes: []string{"password", "key-pair", "oauth"}, Introspection: true,
+	},
+}
+
+// GetCapabilities returns the registered Capabilities for driver, filling
+// in Placeholder from its Dialect.
+func GetCapabilities(driver string) (Capabilities, error) {
+	c, ok := capabilities[driver]
+	if !ok {
+		return Capabilities{}, ErrUnknownDialect
+	}
+
+	c.Placeholder = Dialects[driver].Placeholder
+
+	return c, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// activeQuery describes one in-flight request against POST /, for the live
+// query panel of GET /ui. It intentionally does not carry bind parameter
+// values, matching the redaction-by-default posture of StatementLogger.
+type activeQuery struct {
+	ID        int64     `json:"id"`
+	Profile   string    `json:"profile"`
+	Driver    string    `json:"driver"`
+	SQL       string    `json:"sql"`
+	Client    string    `json:"client"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+var (
+	activeQueries      = make(map[int64]*activeQuery)
+	activeQueriesMutex sync.Mutex
+	activeQuerySeq     int64
+)
+
+// trackQuery records q as in flight and returns a func that removes it
+// again; callers defer the returned func around the query execution it
+// describes.
+func trackQuery(profile, driver, sql, client string) func() {
+	activeQueriesMutex.Lock()
+	activeQuerySeq++
+	id := activeQuerySeq
+	activeQueries[id] = &activeQuery{
+		ID:        id,
+		Profile:   profile,
+		Driver:    driver,
+		SQL:       sql,
+		Client:    client,
+		StartedAt: time.Now(),
+	}
+	activeQueriesMutex.Unlock()
+
+	return func() {
+		activeQueriesMutex.Lock()
+		delete(activeQueries, id)
+		activeQueriesMutex.Unlock()
+	}
+}
+
+// snapshotActiveQueries returns every currently in-flight query, oldest
+// first.
+func snapshotActiveQueries() []*activeQuery {
+	activeQueriesMutex.Lock()
+	defer activeQueriesMutex.Unlock()
+
+	out := make([]*activeQuery, 0, len(activeQueries))
+	for _, q := range activeQueries {
+		out = append(out, q)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+
+	return out
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// basicAuth wraps h so that requests must present the configured admin
+// username and password, rejecting everything else with a 401.
+func basicAuth(user, password string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+
+		if !ok || u != user || p != password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="sql-agent admin"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// goroutineDump writes a textual dump of every running goroutine, useful for
+// diagnosing goroutine pileups without rebuilding the binary.
+func goroutineDump(w http.ResponseWriter, r *http.Request) {
+	buf := make([]byte, 1<<20)
+
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			w.Write(buf[:n])
+			return
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// handleRotatePool handles `POST /pools/{name}/rotate`, rebuilding the named
+// profile's pooled connection with freshly resolved credentials so a
+// password can be rotated without dropping in-flight queries or requiring a
+// restart.
+func handleRotatePool(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/pools/"), "/rotate")
+	if name == "" || name == r.URL.Path {
+		http.Error(w, "missing pool name", http.StatusBadRequest)
+		return
+	}
+
+	profile, ok := sqlagent.GetProfile(sqlagent.DefaultTenant, name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown pool: %s", name), http.StatusNotFound)
+		return
+	}
+
+	if _, err := sqlagent.RotatePool(profile.Driver, profile.Connection); err != nil {
+		http.Error(w, fmt.Sprintf("rotating pool: %s", err), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newAdminMux builds the admin-only mux exposing pprof, expvar, a goroutine
+// dump, and pool rotation. It is meant to be served on a separate port (or
+// behind admin credentials) so it is never reachable alongside the query
+// endpoint.
+func newAdminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/goroutines", goroutineDump)
+	mux.HandleFunc("/pools/", handleRotatePool)
+	mux.HandleFunc("/ui", handleUI)
+	mux.HandleFunc("/ui/data", handleUIData)
+
+	return mux
+}
+
+// serveAdmin starts the admin diagnostics server on addr, requiring the
+// given credentials when they are both non-empty.
+func serveAdmin(addr, user, password string) {
+	mux := newAdminMux()
+
+	var handler http.Handler = mux
+
+	if user != "" && password != "" {
+		handler = basicAuth(user, password, mux)
+	}
+
+	log.Printf("* Admin diagnostics listening on %s...\n", addr)
+
+	if err := http.ListenAndServe(addr, handler); err != nil {
+		log.Printf("admin server stopped: %s\n", err)
+	}
+}
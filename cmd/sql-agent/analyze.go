@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// analyzePayload is the body of a POST /analyze request.
+type analyzePayload struct {
+	SQL string `json:"sql"`
+}
+
+// handleAnalyze serves POST /analyze, a dialect-agnostic SQL-analysis
+// service: it reports the tables, columns, and functions a statement
+// references, each table/column classified as "read" or "write", so
+// lineage tools and access reviewers can use the agent in place of a
+// per-dialect parser.
+func handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload analyzePayload
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte("could not decode JSON: " + err.Error()))
+		return
+	}
+
+	result := sqlagent.Analyze(payload.SQL)
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
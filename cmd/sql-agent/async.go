@@ -0,0 +1,350 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chop-dbhi/sql-agent"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// asyncQueue persists submitted-but-not-finished async queries so an agent
+// restart or crash doesn't silently drop them. A nil queue means the
+// -async-queue-db flag was not set and POST /async is disabled.
+var asyncQueue *asyncJobStore
+
+// asyncJob is one row of the async_jobs table.
+type asyncJob struct {
+	ID          string
+	Payload     string // JSON-encoded Payload, as received.
+	Tenant      string
+	Status      string // queued, running, done, failed
+	Reason      string
+	SubmittedAt time.Time
+}
+
+// asyncJobStore persists asyncJobs to an embedded SQLite database, the same
+// approach historyStore uses for query history.
+type asyncJobStore struct {
+	mu sync.Mutex
+	db *sql.DB
+}
+
+// openAsyncJobStore opens (and initializes, if needed) the async job queue
+// database at path.
+func openAsyncJobStore(path string) (*asyncJobStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	const schema = `
+CREATE TABLE IF NOT EXISTS async_jobs (
+	id           TEXT PRIMARY KEY,
+	payload      TEXT NOT NULL,
+	tenant       TEXT NOT NULL,
+	status       TEXT NOT NULL,
+	reason       TEXT NOT NULL DEFAULT '',
+	submitted_at DATETIME NOT NULL
+);`
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &asyncJobStore{db: db}, nil
+}
+
+func (s *asyncJobStore) insert(j asyncJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(
+		`INSERT INTO async_jobs (id, payload, tenant, status, reason, submitted_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		j.ID, j.Payload, j.Tenant, j.Status, j.Reason, j.SubmittedAt,
+	)
+
+	return err
+}
+
+func (s *asyncJobStore) setStatus(id, status, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`UPDATE async_jobs SET status = ?, reason = ? WHERE id = ?`, status, reason, id)
+	return err
+}
+
+func (s *asyncJobStore) get(id string) (asyncJob, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var j asyncJob
+
+	row := s.db.QueryRow(`SELECT id, payload, tenant, status, reason, submitted_at FROM async_jobs WHERE id = ?`, id)
+	if err := row.Scan(&j.ID, &j.Payload, &j.Tenant, &j.Status, &j.Reason, &j.SubmittedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return asyncJob{}, false, nil
+		}
+		return asyncJob{}, false, err
+	}
+
+	return j, true, nil
+}
+
+// listByStatus returns every job currently in status, used on startup to
+// find work a previous run left behind.
+func (s *asyncJobStore) listByStatus(status string) ([]asyncJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows, err := s.db.Query(`SELECT id, payload, tenant, status, reason, submitted_at FROM async_jobs WHERE status = ?`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []asyncJob
+
+	for rows.Next() {
+		var j asyncJob
+
+		if err := rows.Scan(&j.ID, &j.Payload, &j.Tenant, &j.Status, &j.Reason, &j.SubmittedAt); err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, j)
+	}
+
+	return jobs, rows.Err()
+}
+
+// newAsyncID returns a random hex identifier for a queued job.
+func newAsyncID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// resumeAsyncQueue is called once at startup. Jobs left "queued" by a
+// previous run never started executing, so they're safe to resume as-is.
+// Jobs left "running" were interrupted mid-query and cannot be safely
+// resumed, so they're marked "failed" with a reason explaining why.
+func resumeAsyncQueue() {
+	interrupted, err := asyncQueue.listByStatus("running")
+	if err != nil {
+		log.Printf("could not list interrupted async jobs: %s", err)
+	}
+
+	for _, j := range interrupted {
+		asyncQueue.setStatus(j.ID, "failed", "agent restarted while this query was running")
+	}
+
+	pending, err := asyncQueue.listByStatus("queued")
+	if err != nil {
+		log.Printf("could not list pending async jobs: %s", err)
+		return
+	}
+
+	for _, j := range pending {
+		go runAsyncJob(j)
+	}
+}
+
+// handleAsyncSubmit serves POST /async, persisting the request body (the
+// same fields as POST /) as a queued job before returning, and running it
+// in the background. The response carries the job's id for polling via
+// GET /async/{id}.
+func handleAsyncSubmit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if asyncQueue == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		w.Write([]byte("async query queue is not enabled; set -async-queue-db"))
+		return
+	}
+
+	tenant, ok := tenantFor(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("unknown or missing API key"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte(fmt.Sprintf("could not read request body: %s", err)))
+		return
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte(fmt.Sprintf("could not decode JSON: %s", err)))
+		return
+	}
+
+	if payload.SQL == "" {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte("missing \"sql\" field"))
+		return
+	}
+
+	id, err := newAsyncID()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(fmt.Sprintf("could not generate job id: %s", err)))
+		return
+	}
+
+	job := asyncJob{
+		ID:          id,
+		Payload:     string(body),
+		Tenant:      tenant,
+		Status:      "queued",
+		SubmittedAt: time.Now(),
+	}
+
+	if err := asyncQueue.insert(job); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(fmt.Sprintf("could not persist job: %s", err)))
+		return
+	}
+
+	go runAsyncJob(job)
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"id": id, "status": "queued"})
+}
+
+// handleAsyncStatus serves GET /async/{id}, reporting a queued job's
+// current status and, once it has finished, either its row count or the
+// reason it failed.
+func handleAsyncStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if asyncQueue == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		w.Write([]byte("async query queue is not enabled; set -async-queue-db"))
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/async/")
+	if id == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	tenant, ok := tenantFor(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("unknown or missing API key"))
+		return
+	}
+
+	job, ok, err := asyncQueue.get(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(fmt.Sprintf("could not read job: %s", err)))
+		return
+	}
+
+	if !ok || job.Tenant != tenant {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":           job.ID,
+		"status":       job.Status,
+		"reason":       job.Reason,
+		"submitted_at": job.SubmittedAt,
+	})
+}
+
+// runAsyncJob executes a queued job's query to completion, updating its
+// stored status along the way. It intentionally does not stream rows back
+// to a client (there is none) or apply the synchronous endpoint's buffering
+// or field-option features; it only tracks whether the query ran and how
+// many rows it produced.
+func runAsyncJob(job asyncJob) {
+	asyncQueue.setStatus(job.ID, "running", "")
+
+	var payload Payload
+
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		asyncQueue.setStatus(job.ID, "failed", fmt.Sprintf("could not decode stored payload: %s", err))
+		return
+	}
+
+	var profile *sqlagent.Profile
+
+	if payload.Profile != "" {
+		var ok bool
+
+		profile, ok = sqlagent.GetProfile(job.Tenant, payload.Profile)
+		if !ok {
+			asyncQueue.setStatus(job.ID, "failed", fmt.Sprintf("unknown profile: %v", payload.Profile))
+			return
+		}
+
+		if payload.Driver == "" {
+			payload.Driver = profile.Driver
+		}
+
+		if payload.Connection == nil {
+			payload.Connection = profile.Connection
+		}
+	}
+
+	if _, ok := sqlagent.Drivers[payload.Driver]; !ok {
+		asyncQueue.setStatus(job.ID, "failed", fmt.Sprintf("unknown driver: %v", payload.Driver))
+		return
+	}
+
+	db, err := sqlagent.PersistentConnectProfile(profile, payload.Driver, payload.Connection)
+	if err != nil {
+		asyncQueue.setStatus(job.ID, "failed", fmt.Sprintf("problem connecting to database: %s", err))
+		return
+	}
+
+	iter, err := sqlagent.ExecuteProfile(profile, db, payload.SQL, payload.Params)
+	if err != nil {
+		asyncQueue.setStatus(job.ID, "failed", fmt.Sprintf("error executing query: %s", err))
+		return
+	}
+
+	r := make(sqlagent.Record)
+
+	for iter.Next() {
+		if err := iter.Scan(r); err != nil {
+			asyncQueue.setStatus(job.ID, "failed", fmt.Sprintf("error reading results: %s", err))
+			return
+		}
+	}
+
+	asyncQueue.setStatus(job.ID, "done", fmt.Sprintf("%d rows", iter.RowCount()))
+}
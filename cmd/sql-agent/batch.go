@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// batchStatementPayload is one statement within a POST /exec-batch request.
+type batchStatementPayload struct {
+	SQL    string                 `json:"sql"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// batchPayload is the body of a POST /exec-batch request.
+type batchPayload struct {
+	Driver     string                  `json:"driver"`
+	Connection map[string]interface{} `json:"connection"`
+	Profile    string                  `json:"profile"`
+	Statements []batchStatementPayload `json:"statements"`
+
+	// Tolerant runs each statement inside its own savepoint instead of
+	// failing the whole batch, so one bad statement does not roll back the
+	// statements before and after it.
+	Tolerant bool `json:"tolerant"`
+}
+
+// batchStatementResult reports the outcome of one statement.
+type batchStatementResult struct {
+	RowsAffected int64  `json:"rows_affected"`
+	Error        string `json:"error,omitempty"`
+}
+
+// batchResponse is the body of a POST /exec-batch response.
+type batchResponse struct {
+	Results   []batchStatementResult `json:"results"`
+	Committed bool                   `json:"committed"`
+}
+
+// handleExecBatch serves POST /exec-batch, running a list of write
+// statements inside a single transaction with all-or-nothing semantics (or
+// savepoint-based partial tolerance when requested) instead of requiring
+// the caller to coordinate a transaction across multiple requests.
+func handleExecBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenant, ok := tenantFor(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("unknown or missing API key"))
+		return
+	}
+
+	if quotaExceeded(r.Header.Get("X-Api-Key"), time.Now()) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("usage quota exceeded"))
+		return
+	}
+
+	var payload batchPayload
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte(fmt.Sprintf("could not decode JSON: %s", err)))
+		return
+	}
+
+	var profile *sqlagent.Profile
+
+	if payload.Profile != "" {
+		var ok bool
+
+		profile, ok = sqlagent.GetProfile(tenant, payload.Profile)
+		if !ok {
+			w.WriteHeader(StatusUnprocessableEntity)
+			w.Write([]byte(fmt.Sprintf("unknown profile: %v", payload.Profile)))
+			return
+		}
+
+		if payload.Driver == "" {
+			payload.Driver = profile.Driver
+		}
+
+		if payload.Connection == nil {
+			payload.Connection = profile.Connection
+		}
+	}
+
+	if _, ok := sqlagent.Drivers[payload.Driver]; !ok {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte(fmt.Sprintf("unknown driver: %v", payload.Driver)))
+		return
+	}
+
+	for _, s := range payload.Statements {
+		if warnings := sqlagent.Lint(s.SQL); len(warnings) > 0 && profile.EffectiveLintMode() == "block" {
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": "query blocked by lint policy", "warnings": warnings})
+			return
+		}
+
+		if err := profile.CheckMaintenance(s.SQL, time.Now()); err != nil {
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error(), "code": "profile_in_maintenance"})
+			return
+		}
+	}
+
+	db, err := sqlagent.PersistentConnectProfile(profile, payload.Driver, payload.Connection)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(fmt.Sprintf("problem connecting to database: %s", err)))
+		return
+	}
+
+	if err := profile.Acquire(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(fmt.Sprintf("problem acquiring a connection slot: %s", err)))
+		return
+	}
+	defer profile.Release()
+
+	ctx := context.Background()
+
+	if timeout := profile.EffectiveTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	statements := make([]sqlagent.BatchStatement, len(payload.Statements))
+	for i, s := range payload.Statements {
+		statements[i] = sqlagent.BatchStatement{SQL: s.SQL, Params: s.Params}
+	}
+
+	results, err := sqlagent.ExecBatch(ctx, db, sqlagent.Drivers[payload.Driver], statements, payload.Tolerant)
+
+	out := make([]batchStatementResult, len(results))
+	for i, r := range results {
+		out[i] = batchStatementResult{RowsAffected: r.RowsAffected, Error: r.Error}
+	}
+
+	w.Header().Set("content-type", "application/json")
+
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(batchResponse{Results: out, Committed: false})
+		return
+	}
+
+	json.NewEncoder(w).Encode(batchResponse{Results: out, Committed: true})
+}
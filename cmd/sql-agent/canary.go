@@ -0,0 +1,30 @@
+package main
+
+import (
+	"expvar"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// shadowComparisons counts shadow executions per profile; shadowMismatches
+// counts ones whose shadow backend errored or returned a different row
+// count than the primary result it shadowed.
+var (
+	shadowComparisons = expvar.NewMap("shadow_comparisons")
+	shadowMismatches  = expvar.NewMap("shadow_mismatches")
+)
+
+func init() {
+	sqlagent.ShadowObserver = func(cmp sqlagent.ShadowComparison) {
+		shadowComparisons.Add(cmp.Profile, 1)
+
+		if cmp.Shadow.Err != nil {
+			shadowMismatches.Add(cmp.Profile, 1)
+			return
+		}
+
+		if cmp.Compared && !cmp.RowCountMatch {
+			shadowMismatches.Add(cmp.Profile, 1)
+		}
+	}
+}
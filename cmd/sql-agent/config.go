@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Every flag below can also be set via an environment variable named
+// SQLAGENT_<FLAG_NAME>, with hyphens replaced by underscores and upper-cased
+// (e.g. -history-retention becomes SQLAGENT_HISTORY_RETENTION). Precedence
+// is, highest first: an explicit command-line flag, the environment
+// variable, then the flag's hardcoded default. This lets containerized
+// deployments configure the agent entirely through the environment without
+// a mounted flags file, while keeping local/dev flag overrides working as
+// before.
+
+// envString returns the value of env if set, otherwise fallback.
+func envString(env, fallback string) string {
+	if v, ok := os.LookupEnv(env); ok {
+		return v
+	}
+
+	return fallback
+}
+
+// envInt returns the value of env, parsed as an int, if set and valid,
+// otherwise fallback.
+func envInt(env string, fallback int) int {
+	if v, ok := os.LookupEnv(env); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+
+	return fallback
+}
+
+// envBool returns the value of env, parsed as a bool, if set and valid,
+// otherwise fallback.
+func envBool(env string, fallback bool) bool {
+	if v, ok := os.LookupEnv(env); ok {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+
+	return fallback
+}
+
+// envDuration returns the value of env, parsed as a time.Duration, if set
+// and valid, otherwise fallback.
+func envDuration(env string, fallback time.Duration) time.Duration {
+	if v, ok := os.LookupEnv(env); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+
+	return fallback
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+func init() {
+	sqlagent.DriverLogLevelObserver = applyDriverLogLevel
+}
+
+// applyDriverLogLevel reacts to sqlagent.SetDriverLogLevel by adjusting
+// whatever logging knob the named internal driver actually exposes.
+//
+// gosnowflake (internal name "snowflake") logs through the vendored glog
+// package, which only offers one global, process-wide verbosity level
+// ("-v") rather than a per-package one, so this necessarily turns
+// Snowflake's glog verbosity up or down for the whole process. It is
+// still useful on its own: it's the one driver in this binary that logs
+// through glog at all, so in practice this is already per-driver. If a
+// second vendored driver starts using glog too, this comment is the flag
+// that the two can no longer be told apart at runtime; splitting them
+// would require forking glog or moving that driver off it.
+func applyDriverLogLevel(internal string, level int) {
+	if internal != "snowflake" {
+		return
+	}
+
+	if f := flag.Lookup("v"); f != nil {
+		f.Value.Set(fmt.Sprintf("%d", level))
+	}
+}
+
+// handleDriverLogLevel serves POST /admin/log-level, setting a driver's
+// runtime log verbosity without a restart.
+func handleDriverLogLevel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		Driver string `json:"driver"`
+		Level  int    `json:"level"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte(fmt.Sprintf("could not decode JSON: %s", err)))
+		return
+	}
+
+	internal, ok := sqlagent.Drivers[body.Driver]
+	if !ok {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte(fmt.Sprintf("unknown driver %q", body.Driver)))
+		return
+	}
+
+	sqlagent.SetDriverLogLevel(internal, body.Level)
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"driver": body.Driver, "level": body.Level})
+}
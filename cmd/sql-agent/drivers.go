@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// driverInfo is one entry in a GET /drivers response.
+type driverInfo struct {
+	Driver       string                `json:"driver"`
+	Capabilities sqlagent.Capabilities `json:"capabilities"`
+}
+
+// handleDrivers serves GET /drivers, reporting each registered driver's
+// capabilities (transaction support, placeholder style, auth modes, and
+// so on) so generic clients can adapt their behavior per backend instead
+// of hard-coding it.
+func handleDrivers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	names := make([]string, 0, len(sqlagent.Drivers))
+	for name := range sqlagent.Drivers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	infos := make(map[string]driverInfo, len(names))
+
+	for _, name := range names {
+		internal := sqlagent.Drivers[name]
+
+		if _, unavailable := sqlagent.UnavailableReason(internal); unavailable {
+			// Recognized but not compiled into this binary (e.g. the
+			// build-tag gated oracle/odbc/informix entries); omit it
+			// rather than advertising a driver that can't connect.
+			continue
+		}
+
+		caps, err := sqlagent.GetCapabilities(internal)
+		if err != nil {
+			// No registered Dialect/Capabilities for this driver; omit it
+			// rather than reporting made-up capabilities.
+			continue
+		}
+
+		infos[name] = driverInfo{Driver: internal, Capabilities: caps}
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
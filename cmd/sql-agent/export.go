@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// exportRetention is how long a completed export's spool file is kept
+// available for (resumable) download before being deleted. Set from the
+// -export-retention flag.
+var exportRetention = 15 * time.Minute
+
+// exportSpool is one completed export's file on disk, along with the
+// content-type it was encoded as.
+type exportSpool struct {
+	path     string
+	mimetype string
+}
+
+var (
+	exportSpools      = make(map[string]exportSpool)
+	exportSpoolsMutex sync.Mutex
+)
+
+// newExportToken returns a random hex identifier for a spooled export.
+func newExportToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// spoolExport encodes a fully-buffered result in the requested format to a
+// temporary file and registers it for resumable download via GET
+// /export/{token}, so a large export survives a dropped connection without
+// re-running the query.
+func spoolExport(mimetype, format string, cols []string, buf *sqlagent.RowBuffer) (token string, rows int, err error) {
+	f, err := ioutil.TempFile("", "sqlagent-export-")
+	if err != nil {
+		return "", 0, err
+	}
+
+	switch format {
+	case "csv":
+		err = sqlagent.EncodeBufferedCSV(f, cols, buf)
+	case "ldjson":
+		err = sqlagent.EncodeBufferedLDJSON(f, buf)
+	default:
+		err = sqlagent.EncodeBufferedJSON(f, buf)
+	}
+
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", 0, err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", 0, err
+	}
+
+	token, err = registerExportSpool(f.Name(), mimetype)
+	if err != nil {
+		os.Remove(f.Name())
+		return "", 0, err
+	}
+
+	return token, buf.Len(), nil
+}
+
+// registerExportSpool assigns path a token, making it available at GET
+// /export/{token} until exportRetention elapses, at which point the file
+// is removed.
+func registerExportSpool(path, mimetype string) (string, error) {
+	token, err := newExportToken()
+	if err != nil {
+		return "", err
+	}
+
+	exportSpoolsMutex.Lock()
+	exportSpools[token] = exportSpool{path: path, mimetype: mimetype}
+	exportSpoolsMutex.Unlock()
+
+	time.AfterFunc(exportRetention, func() {
+		exportSpoolsMutex.Lock()
+		delete(exportSpools, token)
+		exportSpoolsMutex.Unlock()
+
+		os.Remove(path)
+	})
+
+	return token, nil
+}
+
+// handleExportDownload serves GET /export/{token}, streaming a
+// previously-spooled export's file with full support for HTTP Range
+// requests via http.ServeContent, so a dropped connection can resume
+// partway through a large download instead of requiring the query to run
+// again.
+func handleExportDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(r.URL.Path, "/export/")
+	if token == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	exportSpoolsMutex.Lock()
+	spool, ok := exportSpools[token]
+	exportSpoolsMutex.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("unknown or expired export token"))
+		return
+	}
+
+	f, err := os.Open(spool.path)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("export file is no longer available"))
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(fmt.Sprintf("could not stat export: %s", err)))
+		return
+	}
+
+	w.Header().Set("content-type", spool.mimetype)
+	http.ServeContent(w, r, token, info.ModTime(), f)
+}
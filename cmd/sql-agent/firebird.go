@@ -0,0 +1,10 @@
+// +build firebird
+
+package main
+
+// Building with `-tags firebird` reaches Firebird via nakagami/firebirdsql,
+// a pure Go driver that isn't vendored under cmd/sql-agent/vendor, so the
+// tag is opt-in rather than part of the default build.
+import (
+	_ "github.com/nakagami/firebirdsql"
+)
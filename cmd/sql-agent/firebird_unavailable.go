@@ -0,0 +1,9 @@
+// +build !firebird
+
+package main
+
+import "github.com/chop-dbhi/sql-agent"
+
+func init() {
+	sqlagent.MarkDriverUnavailable("firebirdsql", "this binary was built without the \"firebird\" tag; rebuild with -tags firebird to enable it")
+}
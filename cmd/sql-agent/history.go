@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// historyRecord describes a single executed query for auditing purposes.
+type historyRecord struct {
+	Fingerprint string    `json:"fingerprint"`
+	Driver      string    `json:"driver"`
+	Status      string    `json:"status"`
+	Duration    float64   `json:"duration"`
+	Rows        int       `json:"rows"`
+	Client      string    `json:"client"`
+	RanAt       time.Time `json:"ran_at"`
+}
+
+// fingerprint returns a stable identifier for a SQL statement, ignoring the
+// parameter values bound to it.
+func fingerprint(sql string) string {
+	sum := sha256.Sum256([]byte(sql))
+	return hex.EncodeToString(sum[:])
+}
+
+// historyStore persists executed-query records to an embedded SQLite
+// database so operators can answer "what ran against prod last night"
+// without external log tooling.
+type historyStore struct {
+	db        *sql.DB
+	retention time.Duration
+}
+
+// openHistoryStore opens (and initializes, if needed) the history database
+// at path.
+func openHistoryStore(path string, retention time.Duration) (*historyStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	const schema = `
+CREATE TABLE IF NOT EXISTS query_history (
+	fingerprint TEXT NOT NULL,
+	driver      TEXT NOT NULL,
+	status      TEXT NOT NULL,
+	duration    REAL NOT NULL,
+	rows        INTEGER NOT NULL,
+	client      TEXT NOT NULL,
+	ran_at      DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS query_history_fingerprint ON query_history (fingerprint);
+CREATE INDEX IF NOT EXISTS query_history_ran_at ON query_history (ran_at);
+`
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &historyStore{db: db, retention: retention}, nil
+}
+
+// Record inserts a query history entry and prunes entries older than the
+// configured retention.
+func (s *historyStore) Record(r historyRecord) error {
+	_, err := s.db.Exec(
+		`INSERT INTO query_history (fingerprint, driver, status, duration, rows, client, ran_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		r.Fingerprint, r.Driver, r.Status, r.Duration, r.Rows, r.Client, r.RanAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if s.retention > 0 {
+		cutoff := r.RanAt.Add(-s.retention)
+		if _, err := s.db.Exec(`DELETE FROM query_history WHERE ran_at < ?`, cutoff); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Recent returns up to limit of the most recently recorded history
+// records, newest first, for GET /ui's dashboard panels.
+func (s *historyStore) Recent(limit int) ([]historyRecord, error) {
+	rows, err := s.db.Query(
+		`SELECT fingerprint, driver, status, duration, rows, client, ran_at FROM query_history ORDER BY ran_at DESC LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []historyRecord
+
+	for rows.Next() {
+		var r historyRecord
+
+		if err := rows.Scan(&r.Fingerprint, &r.Driver, &r.Status, &r.Duration, &r.Rows, &r.Client, &r.RanAt); err != nil {
+			return nil, err
+		}
+
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
+
+// Search returns history records matching the given fingerprint and/or
+// minimum timestamp. Either filter may be left zero-valued to match all.
+func (s *historyStore) Search(fingerprint string, since time.Time) ([]historyRecord, error) {
+	query := `SELECT fingerprint, driver, status, duration, rows, client, ran_at FROM query_history WHERE 1=1`
+
+	var args []interface{}
+
+	if fingerprint != "" {
+		query += ` AND fingerprint = ?`
+		args = append(args, fingerprint)
+	}
+
+	if !since.IsZero() {
+		query += ` AND ran_at >= ?`
+		args = append(args, since)
+	}
+
+	query += ` ORDER BY ran_at DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []historyRecord
+
+	for rows.Next() {
+		var r historyRecord
+
+		if err := rows.Scan(&r.Fingerprint, &r.Driver, &r.Status, &r.Duration, &r.Rows, &r.Client, &r.RanAt); err != nil {
+			return nil, err
+		}
+
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
+
+// history is the process-wide history store. It is nil when history
+// persistence has not been enabled.
+var history *historyStore
+
+// handleHistory serves GET /history?fingerprint=...&since=..., returning the
+// matching query history records as JSON.
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if history == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		w.Write([]byte("history persistence is not enabled"))
+		return
+	}
+
+	var since time.Time
+
+	if v := r.URL.Query().Get("since"); v != "" {
+		if unix, err := strconv.ParseInt(v, 10, 64); err == nil {
+			since = time.Unix(unix, 0)
+		} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+			since = t
+		} else {
+			w.WriteHeader(StatusUnprocessableEntity)
+			w.Write([]byte("since must be a unix timestamp or RFC3339 value"))
+			return
+		}
+	}
+
+	records, err := history.Search(r.URL.Query().Get("fingerprint"), since)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idempotencyWindow is how long a cached response is replayed for a repeated
+// Idempotency-Key. Zero disables idempotency handling entirely.
+var idempotencyWindow time.Duration
+
+// cachedResponse captures everything needed to replay a prior response
+// verbatim for a retried request.
+type cachedResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+var (
+	idempotencyCache      = make(map[string]*cachedResponse)
+	idempotencyCacheMutex sync.Mutex
+
+	// idempotencyInFlight holds one channel per Idempotency-Key currently
+	// executing, closed once that request finishes populating
+	// idempotencyCache. A second concurrent request with the same key -
+	// e.g. a client retry fired after a timeout while the original request
+	// is still running - waits on it instead of re-running h, so it
+	// replays the first request's result rather than double-applying the
+	// write.
+	idempotencyInFlight = make(map[string]chan struct{})
+)
+
+// responseRecorder buffers a response so it can both be sent to the client
+// and stored for replay.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   []byte
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header), status: http.StatusOK}
+}
+
+func (rr *responseRecorder) Header() http.Header { return rr.header }
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.body = append(rr.body, b...)
+	return len(b), nil
+}
+
+func (rr *responseRecorder) WriteHeader(status int) { rr.status = status }
+
+// writeTo flushes the recorded response to w.
+func (rr *responseRecorder) writeTo(w http.ResponseWriter) {
+	for k, vs := range rr.header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+
+	w.WriteHeader(rr.status)
+	w.Write(rr.body)
+}
+
+// withIdempotency wraps h so that requests carrying the same Idempotency-Key
+// within idempotencyWindow replay the original response instead of
+// re-running the query, preventing client-side HTTP retries from
+// double-applying a write.
+func withIdempotency(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+
+		if idempotencyWindow <= 0 || key == "" {
+			h(w, r)
+			return
+		}
+
+		var claimed chan struct{}
+
+		for {
+			idempotencyCacheMutex.Lock()
+
+			cached, ok := idempotencyCache[key]
+			if ok && time.Now().After(cached.expires) {
+				delete(idempotencyCache, key)
+				ok = false
+			}
+
+			if ok {
+				idempotencyCacheMutex.Unlock()
+
+				for k, vs := range cached.header {
+					for _, v := range vs {
+						w.Header().Add(k, v)
+					}
+				}
+
+				w.WriteHeader(cached.status)
+				w.Write(cached.body)
+				return
+			}
+
+			if inFlight, wait := idempotencyInFlight[key]; wait {
+				// Another request with this key is already running h;
+				// wait for it to populate idempotencyCache instead of
+				// running h again, then loop back around to replay its
+				// result.
+				idempotencyCacheMutex.Unlock()
+				<-inFlight
+				continue
+			}
+
+			claimed = make(chan struct{})
+			idempotencyInFlight[key] = claimed
+			idempotencyCacheMutex.Unlock()
+			break
+		}
+
+		// Release the claim - and wake anyone waiting on it - whether h
+		// returns normally or panics, so a failed request doesn't wedge
+		// every later retry of the same key behind a claim nothing will
+		// ever release.
+		defer func() {
+			idempotencyCacheMutex.Lock()
+			delete(idempotencyInFlight, key)
+			idempotencyCacheMutex.Unlock()
+			close(claimed)
+		}()
+
+		rec := newResponseRecorder()
+		h(rec, r)
+
+		idempotencyCacheMutex.Lock()
+		idempotencyCache[key] = &cachedResponse{
+			status:  rec.status,
+			header:  rec.header,
+			body:    rec.body,
+			expires: time.Now().Add(idempotencyWindow),
+		}
+		idempotencyCacheMutex.Unlock()
+
+		rec.writeTo(w)
+	}
+}
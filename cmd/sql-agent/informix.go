@@ -0,0 +1,11 @@
+// +build informix
+
+package main
+
+// Building with `-tags informix` reaches Informix through IBM's combined
+// DB2/Informix driver. It links against the IBM CSDK client libraries via
+// cgo, neither of which ships with this repo, so the tag is opt-in rather
+// than part of the default build.
+import (
+	_ "github.com/ibmdb/go_ibm_db"
+)
@@ -0,0 +1,9 @@
+// +build !informix
+
+package main
+
+import "github.com/chop-dbhi/sql-agent"
+
+func init() {
+	sqlagent.MarkDriverUnavailable("go_ibm_db", "this binary was built without the \"informix\" tag; rebuild with -tags informix and the IBM CSDK client libraries to enable it")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// keepaliveInterval is how often a heartbeat byte is written to a
+// synchronous JSON response whose query has not yet returned, so
+// idle-timeout-minded proxies and load balancers in front of the agent
+// don't sever the connection during a long-running warehouse query before
+// it produces a first row. Zero (the default) disables it. Set from the
+// -keepalive-interval flag.
+var keepaliveInterval time.Duration
+
+// executeWithKeepalive calls run in the background, writing a single space
+// byte to w (insignificant, and so harmless, JSON whitespace) and flushing
+// it every keepaliveInterval while run has not yet returned. wrote reports
+// whether any heartbeat byte was written: once it has been, the response
+// status is already committed to 200 and a subsequent error can only be
+// reported in the body, not via WriteHeader.
+//
+// run is a closure rather than sqlagent.ExecuteProfile's own arguments
+// (*sqlagent.Profile, *sqlx.DB, sql, params) so this file has no reason to
+// import github.com/jmoiron/sqlx itself: cmd/sql-agent vendors its own
+// copy of that package, a distinct type from the one sqlagent's exported
+// signatures use, and the two are not assignable to each other.
+func executeWithKeepalive(w http.ResponseWriter, run func() (*sqlagent.Iterator, error)) (iter *sqlagent.Iterator, err error, wrote bool) {
+	if keepaliveInterval <= 0 {
+		iter, err = run()
+		return iter, err, false
+	}
+
+	type result struct {
+		iter *sqlagent.Iterator
+		err  error
+	}
+
+	ch := make(chan result, 1)
+
+	go func() {
+		i, e := run()
+		ch <- result{i, e}
+	}()
+
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+
+	flusher, _ := w.(http.Flusher)
+
+	for {
+		select {
+		case r := <-ch:
+			return r.iter, r.err, wrote
+		case <-ticker.C:
+			w.Write([]byte(" "))
+			wrote = true
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listen resolves the net.Listener the agent should serve on, preferring
+// systemd socket activation, then an explicit -listen address
+// ("unix:///path/to.sock" or "tcp://host:port"), and finally falling back
+// to host/port for backward compatibility.
+func listen(listenAddr, host string, port int) (net.Listener, error) {
+	if l, ok, err := systemdListener(); ok || err != nil {
+		return l, err
+	}
+
+	if listenAddr == "" {
+		return net.Listen("tcp", fmt.Sprintf("%s:%d", host, port))
+	}
+
+	network, address, err := parseListenAddr(listenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return net.Listen(network, address)
+}
+
+// parseListenAddr splits a "unix:///path" or "tcp://host:port" address into
+// the network and address net.Listen expects.
+func parseListenAddr(listenAddr string) (network, address string, err error) {
+	switch {
+	case strings.HasPrefix(listenAddr, "unix://"):
+		return "unix", strings.TrimPrefix(listenAddr, "unix://"), nil
+	case strings.HasPrefix(listenAddr, "tcp://"):
+		return "tcp", strings.TrimPrefix(listenAddr, "tcp://"), nil
+	default:
+		return "", "", fmt.Errorf("listen address must start with unix:// or tcp://: %q", listenAddr)
+	}
+}
+
+// systemdListener returns the first socket systemd passed via socket
+// activation (file descriptor 3, per the sd_listen_fds protocol), if the
+// process was started that way. This covers the common single-socket case
+// without a dependency on coreos/go-systemd.
+func systemdListener() (net.Listener, bool, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, false, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, false, nil
+	}
+
+	f := os.NewFile(uintptr(3), "LISTEN_FD_3")
+
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, true, err
+	}
+
+	return l, true, nil
+}
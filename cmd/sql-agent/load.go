@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// loadResponse is the body of a POST /load response.
+type loadResponse struct {
+	Table        string `json:"table"`
+	RowsInserted int64  `json:"rows_inserted"`
+	CreatedTable bool   `json:"created_table"`
+}
+
+// handleLoad serves POST /load, loading a CSV, JSON array, or LDJSON
+// multipart upload into table. When the "create" field is "true", the
+// table's schema is inferred from the uploaded data (see
+// sqlagent.InferSchema) and a CREATE TABLE is issued before the first
+// insert, so ad-hoc data can be shared through the agent without
+// hand-written DDL.
+//
+// Besides `file`, the form accepts `format` ("csv", "json", or "ldjson";
+// defaults to "json"), `table`, and the same `driver`, `profile`, and
+// `connection` fields as POST /exec-upload.
+func handleLoad(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenant, ok := tenantFor(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("unknown or missing API key"))
+		return
+	}
+
+	if quotaExceeded(r.Header.Get("X-Api-Key"), time.Now()) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("usage quota exceeded"))
+		return
+	}
+
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte(fmt.Sprintf("could not parse upload: %s", err)))
+		return
+	}
+
+	driver := r.FormValue("driver")
+	profileName := r.FormValue("profile")
+	table := r.FormValue("table")
+	format := r.FormValue("format")
+	createTable := r.FormValue("create") == "true"
+
+	if table == "" {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte("missing \"table\" field"))
+		return
+	}
+
+	var connection map[string]interface{}
+
+	if c := r.FormValue("connection"); c != "" {
+		if err := json.Unmarshal([]byte(c), &connection); err != nil {
+			w.WriteHeader(StatusUnprocessableEntity)
+			w.Write([]byte(fmt.Sprintf("could not decode connection: %s", err)))
+			return
+		}
+	}
+
+	var profile *sqlagent.Profile
+
+	if profileName != "" {
+		var ok bool
+
+		profile, ok = sqlagent.GetProfile(tenant, profileName)
+		if !ok {
+			w.WriteHeader(StatusUnprocessableEntity)
+			w.Write([]byte(fmt.Sprintf("unknown profile: %v", profileName)))
+			return
+		}
+
+		if driver == "" {
+			driver = profile.Driver
+		}
+
+		if connection == nil {
+			connection = profile.Connection
+		}
+	}
+
+	if _, ok := sqlagent.Drivers[driver]; !ok {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte(fmt.Sprintf("unknown driver: %v", driver)))
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte("missing \"file\" upload"))
+		return
+	}
+	defer file.Close()
+
+	contents, err := ioutil.ReadAll(file)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(fmt.Sprintf("error reading upload: %s", err)))
+		return
+	}
+
+	records, err := decodeLoadRecords(format, contents)
+	if err != nil {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte(fmt.Sprintf("could not parse upload: %s", err)))
+		return
+	}
+
+	// A load is always a write, so CheckMaintenance is given a synthetic
+	// INSERT statement rather than real SQL: there is none, since
+	// LoadRecords builds the statements itself from table and records.
+	if err := profile.CheckMaintenance(fmt.Sprintf("INSERT INTO %s", table), time.Now()); err != nil {
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error(), "code": "profile_in_maintenance"})
+		return
+	}
+
+	db, err := sqlagent.PersistentConnectProfile(profile, driver, connection)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(fmt.Sprintf("problem connecting to database: %s", err)))
+		return
+	}
+
+	if err := profile.Acquire(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(fmt.Sprintf("problem acquiring a connection slot: %s", err)))
+		return
+	}
+	defer profile.Release()
+
+	ctx := context.Background()
+
+	if timeout := profile.EffectiveTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	internal := sqlagent.Drivers[driver]
+
+	n, err := sqlagent.LoadRecords(ctx, db, internal, table, records, createTable)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(fmt.Sprintf("error loading data: %s", err)))
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(loadResponse{Table: table, RowsInserted: n, CreatedTable: createTable})
+}
+
+// decodeLoadRecords parses contents as a JSON array of objects (the
+// default), newline-delimited JSON objects, or CSV, sniffing CSV field
+// values into typed Go values so InferSchema can make the same type
+// decisions it would for JSON input.
+func decodeLoadRecords(format string, contents []byte) ([]sqlagent.Record, error) {
+	switch format {
+	case "csv":
+		return decodeCSVRecords(contents)
+	case "ldjson":
+		return decodeLDJSONRecords(contents)
+	case "json", "":
+		return decodeJSONRecords(contents)
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+func decodeCSVRecords(contents []byte) ([]sqlagent.Record, error) {
+	reader := csv.NewReader(bytes.NewReader(contents))
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []sqlagent.Record
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		r := make(sqlagent.Record, len(header))
+		for i, col := range header {
+			if i < len(row) {
+				r[col] = sniffCSVValue(row[i])
+			}
+		}
+
+		records = append(records, r)
+	}
+
+	return records, nil
+}
+
+// sniffCSVValue classifies a raw CSV field as an int64, float64, bool,
+// time.Time, nil (for an empty field), or falls back to the original
+// string, so CSV gets the same type inference JSON input gets for free.
+func sniffCSVValue(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v
+	}
+
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v
+	}
+
+	if v, err := strconv.ParseBool(s); err == nil {
+		return v
+	}
+
+	if v, err := time.Parse(time.RFC3339, s); err == nil {
+		return v
+	}
+
+	return s
+}
+
+func decodeJSONRecords(contents []byte) ([]sqlagent.Record, error) {
+	dec := json.NewDecoder(bytes.NewReader(contents))
+	dec.UseNumber()
+
+	var records []sqlagent.Record
+	if err := dec.Decode(&records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func decodeLDJSONRecords(contents []byte) ([]sqlagent.Record, error) {
+	dec := json.NewDecoder(bytes.NewReader(contents))
+	dec.UseNumber()
+
+	var records []sqlagent.Record
+
+	for {
+		var r sqlagent.Record
+
+		if err := dec.Decode(&r); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		records = append(records, r)
+	}
+
+	return records, nil
+}
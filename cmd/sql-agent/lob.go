@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// lobRetention is how long a spooled LOB value's file is kept available
+// for download before being deleted. Set from the -lob-retention flag.
+var lobRetention = 15 * time.Minute
+
+var (
+	lobSpools      = make(map[string]string) // token -> file path
+	lobSpoolsMutex sync.Mutex
+)
+
+func init() {
+	sqlagent.LOBSink = spoolLOB
+}
+
+// newLOBToken returns a random hex identifier for a spooled LOB value.
+func newLOBToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// spoolLOB writes data to a temporary file and registers it for download
+// via GET /lob/{token} until lobRetention elapses. It's wired up as
+// sqlagent.LOBSink.
+func spoolLOB(data []byte) (string, error) {
+	f, err := ioutil.TempFile("", "sqlagent-lob-")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	token, err := newLOBToken()
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	lobSpoolsMutex.Lock()
+	lobSpools[token] = f.Name()
+	lobSpoolsMutex.Unlock()
+
+	time.AfterFunc(lobRetention, func() {
+		lobSpoolsMutex.Lock()
+		path := lobSpools[token]
+		delete(lobSpools, token)
+		lobSpoolsMutex.Unlock()
+
+		os.Remove(path)
+	})
+
+	return token, nil
+}
+
+// handleLOBDownload serves GET /lob/{token}, streaming a previously
+// spooled large column value with full support for HTTP Range requests
+// via http.ServeContent.
+func handleLOBDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(r.URL.Path, "/lob/")
+	if token == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	lobSpoolsMutex.Lock()
+	path, ok := lobSpools[token]
+	lobSpoolsMutex.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("unknown or expired LOB token"))
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("LOB file is no longer available"))
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(fmt.Sprintf("could not stat LOB: %s", err)))
+		return
+	}
+
+	w.Header().Set("content-type", "application/octet-stream")
+	http.ServeContent(w, r, token, info.ModTime(), f)
+}
@@ -4,18 +4,30 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"mime"
 	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/chop-dbhi/sql-agent"
 
 	_ "github.com/denisenkom/go-mssqldb"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
-	_ "github.com/mattn/go-oci8"
-	_ "github.com/mattn/go-sqlite3"
 	_ "github.com/snowflakedb/gosnowflake"
+
+	// github.com/mattn/go-sqlite3 is imported (not blank) and registered
+	// as the "sqlite3" driver by sqlite.go's tunedSQLiteDriver, not here.
+	//
+	// github.com/mattn/go-oci8 needs the Oracle Instant Client and is
+	// imported only when built with -tags oracle; see oracle.go.
+	//
+	// github.com/nakagami/firebirdsql isn't vendored and is imported only
+	// when built with -tags firebird; see firebird.go.
 )
 
 var usage = `SQL Agent - HTTP interface
@@ -26,6 +38,10 @@ Run:
 
 	sql-agent [-host=<host>] [-port=<port>]
 
+Every flag can also be set via an environment variable named
+SQLAGENT_<FLAG_NAME> (e.g. -history-retention becomes
+SQLAGENT_HISTORY_RETENTION); an explicit flag takes precedence over it.
+
 Example:
 
 	POST /
@@ -46,6 +62,10 @@ Example:
 
 const StatusUnprocessableEntity = 422
 
+// strictMode controls whether request bodies with unknown fields are
+// rejected. Set from the -strict flag in main.
+var strictMode bool
+
 var (
 	defaultMimetype = "application/json"
 
@@ -76,7 +96,11 @@ func parseMimetype(mimetype string) string {
 			return "application/x-ldjson"
 		}
 	default:
-		if _, ok := mimetypeFormats[mimetype]; !ok {
+		// A mimetype outside mimetypeFormats is still accepted if a host
+		// binary has registered a sqlagent.RowEncoder for it, so a custom
+		// output format becomes usable by registering it alone, without
+		// also editing mimetypeFormats or this handler.
+		if _, ok := mimetypeFormats[mimetype]; !ok && !sqlagent.EncoderRegistered(mimetype) {
 			return ""
 		}
 	}
@@ -84,6 +108,24 @@ func parseMimetype(mimetype string) string {
 	return mimetype
 }
 
+// responseVersion resolves which JSON response envelope a request wants:
+// an explicit ?v=2 query parameter wins, then an Accept header "profile"
+// parameter (e.g. "application/json;profile=v2"), defaulting to "1", the
+// legacy bare-array shape EncodeJSON has always produced.
+func responseVersion(r *http.Request, accept string) string {
+	if r.URL.Query().Get("v") == "2" {
+		return "2"
+	}
+
+	if _, params, err := mime.ParseMediaType(accept); err == nil {
+		if params["profile"] == "v2" {
+			return "2"
+		}
+	}
+
+	return "1"
+}
+
 func init() {
 	flag.Usage = func() {
 		fmt.Println(usage)
@@ -95,30 +137,391 @@ func init() {
 
 func main() {
 	var (
-		host string
-		port int
+		host                  string
+		port                  int
+		timeout               time.Duration
+		maxRows               int
+		maxConcurrency        int
+		profilesPath          string
+		adminHost             string
+		adminPort             int
+		adminUser             string
+		adminPassword         string
+		historyPath           string
+		historyTTL            time.Duration
+		strict                bool
+		connectTimeout        time.Duration
+		apiKeysPath           string
+		idempWindow           time.Duration
+		logStatements         bool
+		logRedaction          string
+		logAllowlist          string
+		workloadPath          string
+		workloadKeyPath       string
+		asyncQueuePath        string
+		listenAddr            string
+		signingKey            string
+		defaultLintMode       string
+		queryCachePath        string
+		exportRetentionFlag   time.Duration
+		keepaliveIntervalFlag time.Duration
+		usageQuotasPath       string
+		acquireTimeout        time.Duration
+		sqliteExtensionsFlag  string
+		lobThreshold          int
+		lobRetentionFlag      time.Duration
+		requestSigningKey     string
+		replayWindowFlag      time.Duration
 	)
 
-	flag.StringVar(&host, "host", "localhost", "Host of the agent.")
-	flag.IntVar(&port, "port", 5000, "Port of the agent.")
+	flag.StringVar(&host, "host", envString("SQLAGENT_HOST", "localhost"), "Host of the agent.")
+	flag.IntVar(&port, "port", envInt("SQLAGENT_PORT", 5000), "Port of the agent.")
+	flag.DurationVar(&timeout, "timeout", envDuration("SQLAGENT_TIMEOUT", 0), "Default statement timeout applied to every query. Zero means no timeout.")
+	flag.IntVar(&maxRows, "max-rows", envInt("SQLAGENT_MAX_ROWS", 0), "Default maximum number of rows returned per query. Zero means unlimited.")
+	flag.IntVar(&maxConcurrency, "max-concurrency", envInt("SQLAGENT_MAX_CONCURRENCY", 0), "Default maximum number of concurrent queries per profile. Zero means unlimited.")
+	flag.StringVar(&profilesPath, "profiles", envString("SQLAGENT_PROFILES", ""), "Path to a JSON file of named connection profiles.")
+	flag.StringVar(&adminHost, "admin-host", envString("SQLAGENT_ADMIN_HOST", "localhost"), "Host of the admin diagnostics server.")
+	flag.IntVar(&adminPort, "admin-port", envInt("SQLAGENT_ADMIN_PORT", 0), "Port of the admin diagnostics server (pprof, expvar, goroutine dump). Zero disables it.")
+	flag.StringVar(&adminUser, "admin-user", envString("SQLAGENT_ADMIN_USER", ""), "Username required to access the admin diagnostics server.")
+	flag.StringVar(&adminPassword, "admin-password", envString("SQLAGENT_ADMIN_PASSWORD", ""), "Password required to access the admin diagnostics server.")
+	flag.StringVar(&historyPath, "history-db", envString("SQLAGENT_HISTORY_DB", ""), "Path to a SQLite database used to persist query history. Empty disables history.")
+	flag.DurationVar(&historyTTL, "history-retention", envDuration("SQLAGENT_HISTORY_RETENTION", 30*24*time.Hour), "How long query history records are retained.")
+	flag.BoolVar(&strict, "strict", envBool("SQLAGENT_STRICT", false), "Reject request bodies containing unknown fields instead of silently ignoring them.")
+	flag.DurationVar(&connectTimeout, "connect-timeout", envDuration("SQLAGENT_CONNECT_TIMEOUT", 5*time.Second), "Default timeout for opening new pooled connections. Zero means no timeout.")
+	flag.StringVar(&apiKeysPath, "api-keys", envString("SQLAGENT_API_KEYS", ""), "Path to a JSON file mapping API key to tenant name. Enables multi-tenant isolation.")
+	flag.DurationVar(&idempWindow, "idempotency-window", envDuration("SQLAGENT_IDEMPOTENCY_WINDOW", 0), "How long to deduplicate retried requests bearing the same Idempotency-Key header. Zero disables it.")
+	flag.BoolVar(&logStatements, "log-statements", envBool("SQLAGENT_LOG_STATEMENTS", false), "Log executed SQL statements and bind parameters at debug level.")
+	flag.StringVar(&logRedaction, "log-redaction", envString("SQLAGENT_LOG_REDACTION", "hash"), "How bind parameters are redacted in statement logs: none, all, hash, or allowlist.")
+	flag.StringVar(&logAllowlist, "log-allowlist", envString("SQLAGENT_LOG_ALLOWLIST", ""), "Comma-separated parameter names to log in full when -log-redaction=allowlist.")
+	flag.StringVar(&workloadPath, "workload-groups", envString("SQLAGENT_WORKLOAD_GROUPS", ""), "Path to a JSON file of named workload groups ({\"slots\": N, \"groups\": {\"name\": {\"max_concurrency\": N, \"priority\": N}}}) for fair query scheduling.")
+	flag.StringVar(&workloadKeyPath, "workload-key-groups", envString("SQLAGENT_WORKLOAD_KEY_GROUPS", ""), "Path to a JSON file mapping API key to its default workload group.")
+	flag.StringVar(&asyncQueuePath, "async-queue-db", envString("SQLAGENT_ASYNC_QUEUE_DB", ""), "Path to a SQLite database used to persist the POST /async job queue. Empty disables async query submission.")
+	flag.StringVar(&listenAddr, "listen", envString("SQLAGENT_LISTEN", ""), "Listen address as unix:///path/to.sock or tcp://host:port, overriding -host/-port. systemd socket activation (LISTEN_FDS) takes precedence over this when present.")
+	flag.StringVar(&signingKey, "response-signing-key", envString("SQLAGENT_RESPONSE_SIGNING_KEY", ""), "Secret key used to sign every query response with HMAC-SHA256, reported in an X-Signature trailer. Empty disables signing.")
+	flag.StringVar(&defaultLintMode, "default-lint-mode", envString("SQLAGENT_DEFAULT_LINT_MODE", ""), "Default handling of Lint's anti-pattern warnings for profiles that do not set their own lint_mode: \"\" (disabled), \"warn\", or \"block\".")
+	flag.StringVar(&queryCachePath, "query-cache-templates", envString("SQLAGENT_QUERY_CACHE_TEMPLATES", ""), "Path to a JSON file of named template queries to materialize on a schedule and serve instantly via GET /cache/{name}, invalidated with POST /cache/invalidate. Empty disables the cache.")
+	flag.DurationVar(&exportRetentionFlag, "export-retention", envDuration("SQLAGENT_EXPORT_RETENTION", 15*time.Minute), "How long a spooled export's file is kept available for resumable download via GET /export/{token} before being deleted.")
+	flag.DurationVar(&keepaliveIntervalFlag, "keepalive-interval", envDuration("SQLAGENT_KEEPALIVE_INTERVAL", 0), "How often to write a heartbeat byte to a synchronous JSON response while its query has not yet returned, so idle-timeout-minded proxies and load balancers don't sever the connection during a long-running query. Zero disables it.")
+	flag.StringVar(&usageQuotasPath, "usage-quotas", envString("SQLAGENT_USAGE_QUOTAS", ""), "Path to a JSON file mapping API key to daily/monthly row, byte, and query-second quotas. Exceeding a configured quota rejects further requests with 429 until the period rolls over. Empty disables enforcement; usage is always tracked and reported via GET /usage regardless.")
+	flag.DurationVar(&acquireTimeout, "acquire-timeout", envDuration("SQLAGENT_ACQUIRE_TIMEOUT", 0), "Default time a request waits for a concurrency slot on a profile with max_concurrency set, before failing with a pool_exhausted error. Zero means wait indefinitely.")
+	flag.StringVar(&sqliteExtensionsFlag, "sqlite-extensions", envString("SQLAGENT_SQLITE_EXTENSIONS", ""), "Comma-separated name=path pairs of vetted SQLite loadable extensions (name must be one of math, fts5, json1) a connection's \"extensions\" parameter may request by name. Empty means no extension may be loaded.")
+	flag.IntVar(&lobThreshold, "lob-threshold", envInt("SQLAGENT_LOB_THRESHOLD", 0), "Column values at or above this many bytes are spooled to disk and replaced with a {\"lob_token\", \"bytes\"} reference resolved via GET /lob/{token}, instead of being inlined into the response. Zero disables LOB extraction.")
+	flag.DurationVar(&lobRetentionFlag, "lob-retention", envDuration("SQLAGENT_LOB_RETENTION", 15*time.Minute), "How long a spooled LOB value is kept available via GET /lob/{token} before being deleted.")
+	flag.StringVar(&requestSigningKey, "request-signing-key", envString("SQLAGENT_REQUEST_SIGNING_KEY", ""), "Secret key required to sign POST / requests with HMAC-SHA256 over a timestamp, nonce, and body, rejecting requests outside -replay-window or reusing a nonce. Empty disables the check, appropriate only when the agent is reachable solely from a trusted network.")
+	flag.DurationVar(&replayWindowFlag, "replay-window", envDuration("SQLAGENT_REPLAY_WINDOW", 5*time.Minute), "How far a signed request's timestamp may drift from the server clock, and how long its nonce is remembered, when -request-signing-key is set.")
 
 	flag.Parse()
 
-	addr := fmt.Sprintf("%s:%d", host, port)
-	log.Printf("* Listening on %s...\n", addr)
+	idempotencyWindow = idempWindow
+
+	if signingKey != "" {
+		responseSigningKey = []byte(signingKey)
+	}
+
+	replayWindow = replayWindowFlag
 
-	http.HandleFunc("/", handleRequest)
+	if requestSigningKey != "" {
+		replaySigningKey = []byte(requestSigningKey)
+	}
+
+	exportRetention = exportRetentionFlag
+	keepaliveInterval = keepaliveIntervalFlag
+	sqlagent.LOBThreshold = lobThreshold
+	lobRetention = lobRetentionFlag
+
+	if logStatements {
+		allowlist := make(map[string]bool)
+		for _, name := range strings.Split(logAllowlist, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				allowlist[name] = true
+			}
+		}
+
+		sqlagent.Logger = &sqlagent.StatementLogger{
+			Mode:      sqlagent.RedactionMode(logRedaction),
+			Allowlist: allowlist,
+			Log: func(sql string, params map[string]interface{}) {
+				log.Printf("statement: %s params: %v\n", sql, params)
+			},
+		}
+	}
+
+	strictMode = strict
+	sqlagent.DefaultConnectTimeout = connectTimeout
 
-	err := http.ListenAndServe(addr, nil)
+	sqlagent.DefaultTimeout = timeout
+	sqlagent.DefaultMaxRows = maxRows
+	sqlagent.DefaultMaxConcurrency = maxConcurrency
+	sqlagent.DefaultLintMode = defaultLintMode
+	sqlagent.DefaultAcquireTimeout = acquireTimeout
+
+	if apiKeysPath != "" {
+		if err := loadAPIKeys(apiKeysPath); err != nil {
+			log.Fatalf("could not load API keys: %s", err)
+		}
+	}
+
+	if profilesPath != "" {
+		if err := loadProfiles(profilesPath); err != nil {
+			log.Fatalf("could not load profiles: %s", err)
+		}
+	}
+
+	if workloadPath != "" {
+		var err error
+
+		workloadGroups, err = loadWorkloadGroups(workloadPath)
+		if err != nil {
+			log.Fatalf("could not load workload groups: %s", err)
+		}
+	}
+
+	if workloadKeyPath != "" {
+		if err := loadWorkloadKeyGroups(workloadKeyPath); err != nil {
+			log.Fatalf("could not load workload key groups: %s", err)
+		}
+	}
+
+	if usageQuotasPath != "" {
+		if err := loadUsageQuotas(usageQuotasPath); err != nil {
+			log.Fatalf("could not load usage quotas: %s", err)
+		}
+	}
+
+	if err := loadSQLiteExtensionPaths(sqliteExtensionsFlag); err != nil {
+		log.Fatalf("could not load sqlite extensions: %s", err)
+	}
+
+	if historyPath != "" {
+		var err error
+
+		history, err = openHistoryStore(historyPath, historyTTL)
+		if err != nil {
+			log.Fatalf("could not open history store: %s", err)
+		}
+	}
+
+	if asyncQueuePath != "" {
+		var err error
+
+		asyncQueue, err = openAsyncJobStore(asyncQueuePath)
+		if err != nil {
+			log.Fatalf("could not open async job queue: %s", err)
+		}
+
+		resumeAsyncQueue()
+	}
+
+	if queryCachePath != "" {
+		c, err := loadQueryCache(queryCachePath)
+		if err != nil {
+			log.Fatalf("could not load query cache templates: %s", err)
+		}
+
+		queryCache = c
+		queryCache.start()
+	}
+
+	if adminPort != 0 {
+		adminAddr := fmt.Sprintf("%s:%d", adminHost, adminPort)
+		go serveAdmin(adminAddr, adminUser, adminPassword)
+	}
+
+	l, err := listen(listenAddr, host, port)
+	if err != nil {
+		log.Fatalf("could not listen: %s", err)
+	}
+
+	log.Printf("* Listening on %s...\n", l.Addr())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", withReplayProtection(withRecovery(withIdempotency(handleRequest))))
+	mux.HandleFunc("/history", handleHistory)
+	mux.HandleFunc("/quote", handleQuote)
+	mux.HandleFunc("/schema", handleSchema)
+	mux.HandleFunc("/test-connection", withRecovery(handleTestConnection))
+	mux.HandleFunc("/exec-batch", withReplayProtection(withRecovery(withIdempotency(handleExecBatch))))
+	mux.HandleFunc("/exec-upload", withReplayProtection(withRecovery(withIdempotency(handleSQLUpload))))
+	mux.HandleFunc("/load", withReplayProtection(withRecovery(withIdempotency(handleLoad))))
+	mux.HandleFunc("/async", handleAsyncSubmit)
+	mux.HandleFunc("/async/", handleAsyncStatus)
+	mux.HandleFunc("/drivers", handleDrivers)
+	mux.HandleFunc("/cache/invalidate", handleCacheInvalidate)
+	mux.HandleFunc("/cache/", handleCacheGet)
+	mux.HandleFunc("/export/", handleExportDownload)
+	mux.HandleFunc("/lob/", handleLOBDownload)
+	mux.HandleFunc("/usage", handleUsage)
+	mux.HandleFunc("/analyze", handleAnalyze)
+	mux.HandleFunc("/admin/log-level", handleDriverLogLevel)
+	mux.HandleFunc("/snowflake/queries/", handleSnowflakeQueryStatus)
+
+	err = http.Serve(l, mux)
 	sqlagent.Shutdown()
 	log.Fatal(err)
 }
 
+// profileConfig mirrors sqlagent.Profile for JSON decoding of the
+// -profiles file.
+type profileConfig struct {
+	Driver         string                 `json:"driver"`
+	Connection     map[string]interface{} `json:"connection"`
+	Timeout        time.Duration          `json:"timeout"`
+	MaxRows        int                    `json:"max_rows"`
+	MaxConcurrency int                    `json:"max_concurrency"`
+	AcquireTimeout time.Duration          `json:"acquire_timeout"`
+	Shadow         *shadowConfig          `json:"shadow"`
+}
+
+// shadowConfig mirrors sqlagent.ShadowConfig for JSON decoding of a
+// profile's "shadow" key.
+type shadowConfig struct {
+	Driver     string                 `json:"driver"`
+	Connection map[string]interface{} `json:"connection"`
+	SampleRate float64                `json:"sample_rate"`
+	Timeout    time.Duration          `json:"timeout"`
+}
+
+// loadProfiles reads a JSON file of named connection profiles and registers
+// each of them with the sqlagent package.
+func loadProfiles(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var cfgs map[string]profileConfig
+
+	if err := json.Unmarshal(b, &cfgs); err != nil {
+		return err
+	}
+
+	for name, c := range cfgs {
+		p := &sqlagent.Profile{
+			Name:           name,
+			Driver:         c.Driver,
+			Connection:     c.Connection,
+			Timeout:        c.Timeout,
+			MaxRows:        c.MaxRows,
+			MaxConcurrency: c.MaxConcurrency,
+			AcquireTimeout: c.AcquireTimeout,
+		}
+
+		if c.Shadow != nil {
+			p.Shadow = &sqlagent.ShadowConfig{
+				Driver:     c.Shadow.Driver,
+				Connection: c.Shadow.Connection,
+				SampleRate: c.Shadow.SampleRate,
+				Timeout:    c.Shadow.Timeout,
+			}
+		}
+
+		sqlagent.RegisterProfile(sqlagent.DefaultTenant, name, p)
+	}
+
+	return nil
+}
+
 type Payload struct {
-	Driver     string
-	Connection map[string]interface{}
-	SQL        string
-	Params     map[string]interface{}
+	Driver      string
+	Connection  map[string]interface{}
+	Profile     string
+	SQL         string
+	Params      map[string]interface{}
+	Materialize string
+
+	// Buffer requests a non-streaming response: the full result is
+	// materialized (spilling to disk past sqlagent.MaxBufferedBytes)
+	// before any bytes are written, so a mid-query failure returns a
+	// clean error instead of a truncated body.
+	Buffer bool
+
+	// Select, Rename, Flatten, and Case configure a sqlagent.FieldOptions
+	// applied to JSON/LDJSON output; see that type's doc comment. They
+	// have no effect on CSV output.
+	Select  []string
+	Rename  map[string]string
+	Flatten bool
+	Case    string
+
+	// Transforms computes or renames columns via sqlagent.Transforms
+	// before Select/Rename/Flatten/Case run. Like those, it only applies
+	// to Record-based output.
+	Transforms sqlagent.Transforms `json:"transforms"`
+
+	// FetchSize requests the underlying driver fetch this many rows per
+	// round trip to the server, for drivers whose vendored client library
+	// exposes that knob; see sqlagent.ApplyFetchSize. A value greater than
+	// zero for a driver without one sets the X-Fetch-Size-Applied response
+	// header to "false" rather than silently having no effect.
+	FetchSize int `json:"fetch_size"`
+
+	// Snapshot requests a point-in-time read as of this timestamp, via
+	// sqlagent.DecorateSnapshot, instead of hand-crafted dialect SQL. Zero
+	// value means a normal, non-snapshot read.
+	Snapshot time.Time
+
+	// PageSize requests server-side pagination via sqlagent.Paginate
+	// instead of hand-written LIMIT/OFFSET or keyset SQL. Zero disables
+	// pagination and the rest of these fields are ignored. After, when
+	// set, requests keyset pagination instead of PageOffset; see
+	// sqlagent.PageRequest for the full semantics.
+	PageSize   int         `json:"page_size"`
+	PageOffset int         `json:"page_offset"`
+	SortKey    string      `json:"sort_key"`
+	After      interface{} `json:"after"`
+
+	// Export requests a spooled, resumable download instead of a direct
+	// response: the full result is buffered and encoded to a temporary
+	// file (see spoolExport), and the response instead carries a token for
+	// GET /export/{token}, which supports HTTP Range requests so a dropped
+	// connection can resume without re-running the query.
+	Export bool `json:"export"`
+
+	// MultiStatement runs SQL as a block of statements (split the same way
+	// POST /exec-upload splits a script) against a single held connection
+	// via sqlagent.ExecuteMultiStatement, instead of as one statement. Use
+	// it for a Snowflake block like "USE WAREHOUSE X; SELECT ...", where
+	// the session-state USE statement would otherwise be lost to a
+	// different pooled connection on a separate request.
+	MultiStatement bool `json:"multi_statement"`
+
+	// Deterministic requests byte-stable output across runs over unchanged
+	// data: it requires SortKey, and forces a full buffer of the result
+	// (like Buffer) so rows can be sorted by SortKey with a stable tiebreak
+	// across every other column before encoding. encoding/json already
+	// sorts map keys, so this is the one remaining source of
+	// run-to-run nondeterminism: row order among ties the database itself
+	// didn't fully order.
+	Deterministic bool `json:"deterministic"`
+}
+
+// errorResponse is the structured body written when a request fails with an
+// unrecovered panic.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: msg})
+}
+
+// withRecovery wraps h so that a panic inside it, such as one thrown by a
+// driver when it receives malformed data, is converted into a structured
+// 500 response with the stack trace captured to the log instead of taking
+// down every other in-flight request.
+func withRecovery(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Printf("panic handling request: %v\n%s", rec, debug.Stack())
+				writeError(w, http.StatusInternalServerError, "internal error handling query")
+			}
+		}()
+
+		h(w, r)
+	}
 }
 
 func handleRequest(w http.ResponseWriter, r *http.Request) {
@@ -129,59 +532,451 @@ func handleRequest(w http.ResponseWriter, r *http.Request) {
 
 	// Validate the Accept header and parse it to ensure it is
 	// supported.
-	mimetype := r.Header.Get("Accept")
+	accept := r.Header.Get("Accept")
+	mimetype := parseMimetype(accept)
 
-	if mimetype = parseMimetype(mimetype); mimetype == "" {
+	if mimetype == "" {
 		w.WriteHeader(http.StatusNotAcceptable)
 		return
 	}
 
+	version := responseVersion(r, accept)
+
+	tenant, ok := tenantFor(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("unknown or missing API key"))
+		return
+	}
+
+	if quotaExceeded(r.Header.Get("X-Api-Key"), time.Now()) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("usage quota exceeded"))
+		return
+	}
+
 	var payload Payload
 
-	// Decode the body.
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+	// Decode the body. In strict mode, unknown fields (e.g. a typo like
+	// "paramaters") are rejected instead of silently ignored, which
+	// otherwise manifests later as a confusing empty-bind failure.
+	dec := json.NewDecoder(r.Body)
+
+	if strictMode {
+		dec.DisallowUnknownFields()
+	}
+
+	if err := dec.Decode(&payload); err != nil {
 		w.WriteHeader(StatusUnprocessableEntity)
 		w.Write([]byte(fmt.Sprintf("could not decode JSON: %s", err)))
 		return
 	}
 
+	var profile *sqlagent.Profile
+
+	if payload.Profile != "" {
+		var ok bool
+
+		profile, ok = sqlagent.GetProfile(tenant, payload.Profile)
+		if !ok {
+			w.WriteHeader(StatusUnprocessableEntity)
+			w.Write([]byte(fmt.Sprintf("unknown profile: %v", payload.Profile)))
+			return
+		}
+
+		if payload.Driver == "" {
+			payload.Driver = profile.Driver
+		}
+
+		if payload.Connection == nil {
+			payload.Connection = profile.Connection
+		}
+	}
+
 	if _, ok := sqlagent.Drivers[payload.Driver]; !ok {
 		w.WriteHeader(StatusUnprocessableEntity)
 		w.Write([]byte(fmt.Sprintf("unknown driver: %v", payload.Driver)))
 		return
 	}
 
-	db, err := sqlagent.PersistentConnect(payload.Driver, payload.Connection)
+	lintWarnings := sqlagent.Lint(payload.SQL)
+
+	if len(lintWarnings) > 0 && profile.EffectiveLintMode() == "block" {
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": "query blocked by lint policy", "warnings": lintWarnings})
+		return
+	}
+
+	if err := profile.CheckMaintenance(payload.SQL, time.Now()); err != nil {
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error(), "code": "profile_in_maintenance"})
+		return
+	}
+
+	if !payload.Snapshot.IsZero() {
+		decorated, err := sqlagent.DecorateSnapshot(payload.Driver, payload.SQL, payload.Snapshot)
+		if err != nil {
+			w.WriteHeader(StatusUnprocessableEntity)
+			w.Write([]byte(fmt.Sprintf("could not apply snapshot option: %s", err)))
+			return
+		}
+
+		payload.SQL = decorated
+	}
+
+	if payload.PageSize > 0 {
+		paged, err := sqlagent.Paginate(sqlagent.Drivers[payload.Driver], payload.SQL, sqlagent.PageRequest{
+			Limit:   payload.PageSize,
+			Offset:  payload.PageOffset,
+			SortKey: payload.SortKey,
+			After:   payload.After,
+		})
+		if err != nil {
+			w.WriteHeader(StatusUnprocessableEntity)
+			w.Write([]byte(fmt.Sprintf("could not apply pagination: %s", err)))
+			return
+		}
+
+		payload.SQL = paged
+	}
+
+	connectionParams := payload.Connection
+
+	if payload.FetchSize > 0 {
+		var applied bool
+		connectionParams, applied = sqlagent.ApplyFetchSize(sqlagent.Drivers[payload.Driver], payload.Connection, payload.FetchSize)
+		w.Header().Set("X-Fetch-Size-Applied", strconv.FormatBool(applied))
+	}
+
+	db, err := sqlagent.PersistentConnectProfile(profile, payload.Driver, connectionParams)
 	if err != nil {
+		if unavailable, ok := err.(*sqlagent.DriverUnavailableError); ok {
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": unavailable.Error(), "code": "driver_unavailable"})
+			return
+		}
+
 		w.WriteHeader(http.StatusServiceUnavailable)
 		w.Write([]byte(fmt.Sprintf("problem connecting to database: %s", err)))
 		return
 	}
 
-	iter, err := sqlagent.Execute(db, payload.SQL, payload.Params)
+	// Wait for a slot in the request's workload group before running
+	// anything, so a flood of low-priority queries cannot starve a
+	// higher-priority group sharing the same agent.
+	release := acquireWorkloadSlot(r)
+	defer release()
+
+	start := time.Now()
+
+	done := trackQuery(payload.Profile, payload.Driver, payload.SQL, r.RemoteAddr)
+	defer done()
+
+	if payload.MultiStatement {
+		results, err := sqlagent.ExecuteMultiStatement(db, sqlagent.Drivers[payload.Driver], payload.SQL, payload.Params)
+		if err != nil {
+			recordHistory(payload, r, "error", start, 0)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(fmt.Sprintf("error executing multi-statement block: %s", err)))
+			return
+		}
+
+		rows := 0
+		for _, res := range results {
+			rows += len(res.Rows)
+		}
+
+		recordHistory(payload, r, "success", start, rows)
+		recordUsage(r, rows, 0, time.Since(start).Seconds())
+
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+		return
+	}
+
+	if payload.Materialize != "" {
+		rows, err := sqlagent.Materialize(db, sqlagent.Drivers[payload.Driver], payload.Materialize, payload.SQL, payload.Params)
+
+		if err != nil {
+			recordHistory(payload, r, "error", start, 0)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(fmt.Sprintf("error materializing query: %s", err)))
+			return
+		}
+
+		recordHistory(payload, r, "success", start, int(rows))
+		recordUsage(r, int(rows), 0, time.Since(start).Seconds())
+
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"table": payload.Materialize,
+			"rows":  rows,
+		})
+		return
+	}
+
+	// Only synchronous JSON responses get heartbeat bytes while waiting on
+	// the query: CSV/LDJSON consumers generally parse line-by-line or
+	// column-by-column and a stray byte ahead of the real payload would
+	// corrupt the output, whereas leading whitespace before a JSON value is
+	// insignificant and any conforming JSON parser ignores it.
+	var (
+		iter      *sqlagent.Iterator
+		keptAlive bool
+	)
+
+	if mimetypeFormats[mimetype] == "json" {
+		iter, err, keptAlive = executeWithKeepalive(w, func() (*sqlagent.Iterator, error) {
+			return sqlagent.ExecuteProfile(profile, db, payload.SQL, payload.Params)
+		})
+	} else {
+		iter, err = sqlagent.ExecuteProfile(profile, db, payload.SQL, payload.Params)
+	}
 
 	if err != nil {
+		recordHistory(payload, r, "error", start, 0)
+
+		// Once a heartbeat byte has been written the response status is
+		// already committed to 200, so the failure has to be reported in
+		// the body instead of via WriteHeader.
+		if keptAlive {
+			code := ""
+			if err == sqlagent.ErrStatementTimeout {
+				code = "deadline_exceeded"
+			} else if err == sqlagent.ErrPoolExhausted {
+				code = "pool_exhausted"
+			}
+
+			w.Write([]byte(fmt.Sprintf(" {\"error\": %q, \"code\": %q}", err.Error(), code)))
+			return
+		}
+
+		if err == sqlagent.ErrStatementTimeout {
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(http.StatusGatewayTimeout)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error(), "code": "deadline_exceeded"})
+			return
+		}
+
+		if err == sqlagent.ErrPoolExhausted {
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error(), "code": "pool_exhausted"})
+			return
+		}
+
 		w.WriteHeader(http.StatusServiceUnavailable)
 		w.Write([]byte(fmt.Sprintf("error executing query: %s", err)))
 		return
 	}
 
+	// Registered before defer iter.Close() so it runs after (defers unwind
+	// LIFO): QueryID is only populated once Close has run its
+	// LAST_QUERY_ID() lookup.
+	if payload.Driver == "snowflake" {
+		defer func() {
+			if iter.QueryID != "" {
+				w.Header().Set("X-Snowflake-Query-ID", iter.QueryID)
+			}
+		}()
+	}
+
 	defer iter.Close()
 
+	// Stop fetching rows once the client disconnects instead of continuing
+	// to pull the full result set into a response nobody will read. An
+	// export spools to disk independently of the client connection, so it
+	// deliberately keeps running after a disconnect instead.
+	if !payload.Export {
+		iter.SetContext(r.Context())
+	}
+
+	// Transforms/field selection/renaming/flattening only apply to
+	// Record-based output (JSON/LDJSON); CSV stays tied to the query's
+	// own columns.
+	if mimetypeFormats[mimetype] != "csv" && len(payload.Transforms) > 0 {
+		iter.SetTransforms(payload.Transforms)
+	}
+
+	if mimetypeFormats[mimetype] != "csv" && (len(payload.Select) > 0 || len(payload.Rename) > 0 || payload.Flatten || payload.Case != "") {
+		iter.SetFieldOptions(&sqlagent.FieldOptions{
+			Select:  payload.Select,
+			Rename:  payload.Rename,
+			Flatten: payload.Flatten,
+			Case:    payload.Case,
+		})
+	}
+
+	if payload.Export {
+		buf, err := sqlagent.Buffer(iter)
+		if err != nil {
+			recordHistory(payload, r, "error", start, 0)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(fmt.Sprintf("error buffering data: %s", err)))
+			return
+		}
+		defer buf.Close()
+
+		token, rows, err := spoolExport(mimetype, mimetypeFormats[mimetype], iter.Cols, buf)
+		if err != nil {
+			recordHistory(payload, r, "error", start, 0)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(fmt.Sprintf("error writing export: %s", err)))
+			return
+		}
+
+		recordHistory(payload, r, "success", start, rows)
+		recordUsage(r, rows, 0, time.Since(start).Seconds())
+
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"export_token": token,
+			"rows":         rows,
+			"download_url": "/export/" + token,
+		})
+		return
+	}
+
+	// In buffered mode, materialize the full result (spilling to disk past
+	// sqlagent.MaxBufferedBytes) before writing anything, so a failure
+	// partway through the query surfaces as a clean error instead of a
+	// truncated body. Deterministic mode always buffers too: producing a
+	// stable tiebreak ordering requires the full result set in hand before
+	// any of it can be written out.
+	var buf *sqlagent.RowBuffer
+
+	switch {
+	case payload.Deterministic:
+		if payload.SortKey == "" {
+			w.WriteHeader(StatusUnprocessableEntity)
+			w.Write([]byte("deterministic requires sort_key"))
+			return
+		}
+
+		buf, err = sqlagent.BufferSorted(iter, payload.SortKey)
+
+	case payload.Buffer:
+		buf, err = sqlagent.Buffer(iter)
+	}
+
+	if err != nil {
+		recordHistory(payload, r, "error", start, 0)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(fmt.Sprintf("error buffering data: %s", err)))
+		return
+	}
+
+	if buf != nil {
+		defer buf.Close()
+	}
+
 	w.Header().Set("content-type", mimetype)
 
-	switch mimetypeFormats[mimetype] {
-	case "csv":
-		err = sqlagent.EncodeCSV(w, iter)
-	case "json":
-		err = sqlagent.EncodeJSON(w, iter)
-	case "ldjson":
-		err = sqlagent.EncodeLDJSON(w, iter)
+	if len(lintWarnings) > 0 {
+		if encoded, err := json.Marshal(lintWarnings); err == nil {
+			w.Header().Set("X-Lint-Warnings", string(encoded))
+		}
+	}
+
+	trailerNames := "X-Row-Count, X-Checksum, X-Complete"
+	if responseSigningKey != nil {
+		trailerNames += ", X-Signature"
+	}
+	if payload.Driver == "snowflake" {
+		trailerNames += ", X-Snowflake-Query-ID"
+	}
+
+	w.Header().Set("Trailer", trailerNames)
+
+	cw := newChecksumWriter(w, responseSigningKey)
+
+	envelopeMeta := sqlagent.EnvelopeMeta{"driver": payload.Driver}
+	if len(lintWarnings) > 0 {
+		envelopeMeta["lint_warnings"] = lintWarnings
+	}
+
+	if buf != nil {
+		switch mimetypeFormats[mimetype] {
+		case "csv":
+			err = sqlagent.EncodeBufferedCSV(cw, iter.Cols, buf)
+		case "json":
+			if version == "2" {
+				err = sqlagent.EncodeBufferedJSONEnvelope(cw, iter.Cols, buf, envelopeMeta)
+			} else {
+				err = sqlagent.EncodeBufferedJSON(cw, buf)
+			}
+		case "ldjson":
+			err = sqlagent.EncodeBufferedLDJSON(cw, buf)
+		default:
+			// A custom format registered only via sqlagent.RegisterEncoder
+			// has no buffered equivalent yet: EncodeStream needs a live
+			// *Iterator, not a materialized RowBuffer.
+			err = fmt.Errorf("buffering is not supported for %q", mimetype)
+		}
+	} else {
+		switch mimetypeFormats[mimetype] {
+		case "csv":
+			err = sqlagent.EncodeCSV(cw, iter)
+		case "json":
+			if version == "2" {
+				err = sqlagent.EncodeJSONEnvelope(cw, iter, envelopeMeta)
+			} else {
+				err = sqlagent.EncodeJSON(cw, iter)
+			}
+		case "ldjson":
+			err = sqlagent.EncodeLDJSON(cw, iter)
+		default:
+			// Not one of the built-in formats: dispatch to whatever
+			// sqlagent.RowEncoder a host binary registered for mimetype,
+			// so a new output format becomes usable without this switch
+			// needing to know about it.
+			err = sqlagent.EncodeStream(mimetype, cw, iter)
+		}
 	}
 
 	if err != nil {
+		recordHistory(payload, r, "error", start, 0)
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(fmt.Sprintf("error encoding data: %s", err)))
+		writeResultTrailer(w, cw, iter.RowCount(), false)
+		return
+	}
+
+	writeResultTrailer(w, cw, iter.RowCount(), r.Context().Err() == nil)
+	recordHistory(payload, r, "success", start, iter.RowCount())
+	recordUsage(r, iter.RowCount(), cw.Bytes(), time.Since(start).Seconds())
+
+	// Shadowing compares against this request's own row count, which is
+	// only known once the response is fully written, so it runs last. It
+	// always launches in the background and never affects the response
+	// already sent to the client.
+	if profile != nil && sqlagent.ShouldShadow(profile.Shadow) {
+		sqlagent.RunShadow(payload.Profile, profile.Shadow, payload.SQL, payload.Params, sqlagent.ShadowResult{Rows: iter.RowCount()}, true)
+	}
+}
+
+// recordHistory persists a query history entry, if history persistence is
+// enabled. Failures are logged rather than surfaced, since the query itself
+// already succeeded or failed independently.
+func recordHistory(payload Payload, r *http.Request, status string, start time.Time, rows int) {
+	if history == nil {
 		return
 	}
+
+	rec := historyRecord{
+		Fingerprint: fingerprint(payload.SQL),
+		Driver:      payload.Driver,
+		Status:      status,
+		Duration:    time.Since(start).Seconds(),
+		Rows:        rows,
+		Client:      r.RemoteAddr,
+		RanAt:       start,
+	}
+
+	if err := history.Record(rec); err != nil {
+		log.Printf("could not record query history: %s\n", err)
+	}
 }
@@ -0,0 +1,13 @@
+// +build odbc
+
+package main
+
+// Building with `-tags odbc` reaches backends without a native Go driver —
+// Teradata, Netezza, Progress, and others — through an installed ODBC DSN.
+// It requires a system ODBC driver manager (unixODBC on Linux) and
+// alexbrainman/odbc vendored under cmd/sql-agent/vendor, neither of which
+// ships with this repo, so the tag is opt-in rather than part of the
+// default build.
+import (
+	_ "github.com/alexbrainman/odbc"
+)
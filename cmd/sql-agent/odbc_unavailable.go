@@ -0,0 +1,9 @@
+// +build !odbc
+
+package main
+
+import "github.com/chop-dbhi/sql-agent"
+
+func init() {
+	sqlagent.MarkDriverUnavailable("odbc", "this binary was built without the \"odbc\" tag; rebuild with -tags odbc and an installed ODBC driver manager (unixODBC on Linux) to enable it")
+}
@@ -0,0 +1,11 @@
+// +build oracle
+
+package main
+
+// Building with `-tags oracle` reaches Oracle through go-oci8, which links
+// against the Oracle Instant Client via cgo and pkg-config (oci8.pc),
+// neither of which ships with this repo, so the tag is opt-in rather than
+// part of the default build.
+import (
+	_ "github.com/mattn/go-oci8"
+)
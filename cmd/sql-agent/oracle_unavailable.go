@@ -0,0 +1,9 @@
+// +build !oracle
+
+package main
+
+import "github.com/chop-dbhi/sql-agent"
+
+func init() {
+	sqlagent.MarkDriverUnavailable("oci8", "this binary was built without the \"oracle\" tag; rebuild with -tags oracle and an installed Oracle Instant Client (oci8.pc on PKG_CONFIG_PATH) to enable it")
+}
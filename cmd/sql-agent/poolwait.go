@@ -0,0 +1,29 @@
+package main
+
+import (
+	"expvar"
+	"time"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// poolWaitSeconds and poolWaitCount are a sum and count per profile, not a
+// true histogram (expvar has no bucketed-distribution type); dividing one
+// by the other gives an operator the mean acquire wait, which is enough to
+// size MaxConcurrency from without vendoring a metrics library.
+var (
+	poolWaitSeconds    = expvar.NewMap("pool_wait_seconds_total")
+	poolWaitCount      = expvar.NewMap("pool_wait_count")
+	poolExhaustedTotal = expvar.NewMap("pool_exhausted_total")
+)
+
+func init() {
+	sqlagent.PoolWaitObserver = func(profile string, waited time.Duration, timedOut bool) {
+		poolWaitSeconds.AddFloat(profile, waited.Seconds())
+		poolWaitCount.Add(profile, 1)
+
+		if timedOut {
+			poolExhaustedTotal.Add(profile, 1)
+		}
+	}
+}
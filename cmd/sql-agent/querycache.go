@@ -0,0 +1,408 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// queryCache serves pre-materialized results for registered template
+// queries instantly instead of running them against the upstream database
+// on every request. A nil cache means the -query-cache-templates flag was
+// not set and GET /cache/{name} and POST /cache/invalidate are disabled.
+var queryCache *templateCache
+
+// queryTemplateConfig mirrors a queryTemplate's static configuration for
+// JSON decoding of the -query-cache-templates file.
+type queryTemplateConfig struct {
+	SQL     string                 `json:"sql"`
+	Driver  string                 `json:"driver"`
+	Profile string                 `json:"profile"`
+	Params  map[string]interface{} `json:"params"`
+	Tags    []string               `json:"tags"`
+
+	// Refresh is a time.ParseDuration string, e.g. "5m". Empty or zero
+	// means the template is materialized once at startup and only
+	// refreshed on explicit invalidation.
+	Refresh string `json:"refresh"`
+
+	// OnDrift controls what happens when a refresh returns a different set
+	// of columns or column types than the previous successful refresh:
+	// "" or "warn" (the default) keeps serving the new result with a
+	// schema_drift_warning attached, "fail" rejects it and keeps serving
+	// the last result that matched the established schema.
+	OnDrift string `json:"on_drift"`
+}
+
+// queryTemplate is one registered template query: a query that is
+// materialized on a schedule, by name, rather than run synchronously per
+// request.
+type queryTemplate struct {
+	Name    string
+	SQL     string
+	Driver  string
+	Profile string
+	Params  map[string]interface{}
+	Tags    []string
+	Refresh time.Duration
+	OnDrift string
+}
+
+// cachedResult is the most recently materialized output of one template.
+type cachedResult struct {
+	Columns            []string          `json:"columns"`
+	Rows               []sqlagent.Record `json:"rows"`
+	UpdatedAt          time.Time         `json:"updated_at"`
+	Err                string            `json:"error,omitempty"`
+	SchemaDriftWarning string            `json:"schema_drift_warning,omitempty"`
+}
+
+// schemaSignature identifies a result set's shape (column names and, where
+// the driver reports them, their types) for drift detection across
+// successive refreshes of the same template.
+type schemaSignature struct {
+	Columns []string
+	Types   []string
+}
+
+// diff describes how two schema signatures differ, or "" if they don't.
+func (s schemaSignature) diff(o schemaSignature) string {
+	if len(s.Columns) != len(o.Columns) {
+		return fmt.Sprintf("column count changed from %d to %d (was %v, now %v)", len(s.Columns), len(o.Columns), s.Columns, o.Columns)
+	}
+
+	for i, col := range s.Columns {
+		if col != o.Columns[i] {
+			return fmt.Sprintf("column %d changed from %q to %q", i, col, o.Columns[i])
+		}
+
+		if i < len(s.Types) && i < len(o.Types) && s.Types[i] != o.Types[i] {
+			return fmt.Sprintf("column %q changed type from %q to %q", col, s.Types[i], o.Types[i])
+		}
+	}
+
+	return ""
+}
+
+// templateCache holds the registered templates and the most recent
+// materialized result for each, refreshed on its own schedule (or only on
+// explicit invalidation, for templates with no Refresh set).
+type templateCache struct {
+	mu        sync.RWMutex
+	templates map[string]queryTemplate
+	results   map[string]*cachedResult
+	schemas   map[string]schemaSignature
+}
+
+// loadQueryCache reads a JSON file of named template queries
+// ({"name": {"sql": "...", "driver": "...", "refresh": "5m", "tags": [...]}})
+// and returns a templateCache with each one registered, not yet
+// materialized.
+func loadQueryCache(path string) (*templateCache, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg map[string]queryTemplateConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, err
+	}
+
+	c := &templateCache{
+		templates: make(map[string]queryTemplate),
+		results:   make(map[string]*cachedResult),
+		schemas:   make(map[string]schemaSignature),
+	}
+
+	for name, tc := range cfg {
+		var refresh time.Duration
+
+		if tc.Refresh != "" {
+			refresh, err = time.ParseDuration(tc.Refresh)
+			if err != nil {
+				return nil, fmt.Errorf("template %q: invalid refresh duration: %s", name, err)
+			}
+		}
+
+		switch tc.OnDrift {
+		case "", "warn", "fail":
+		default:
+			return nil, fmt.Errorf("template %q: invalid on_drift %q: must be \"warn\" or \"fail\"", name, tc.OnDrift)
+		}
+
+		c.templates[name] = queryTemplate{
+			Name:    name,
+			SQL:     tc.SQL,
+			Driver:  tc.Driver,
+			Profile: tc.Profile,
+			Params:  tc.Params,
+			Tags:    tc.Tags,
+			Refresh: refresh,
+			OnDrift: tc.OnDrift,
+		}
+	}
+
+	return c, nil
+}
+
+// start materializes every registered template immediately, then again on
+// its own ticker for as long as the process runs.
+func (c *templateCache) start() {
+	for _, tmpl := range c.templates {
+		go c.refreshLoop(tmpl)
+	}
+}
+
+func (c *templateCache) refreshLoop(tmpl queryTemplate) {
+	c.refresh(tmpl)
+
+	if tmpl.Refresh <= 0 {
+		return
+	}
+
+	for range time.Tick(tmpl.Refresh) {
+		c.refresh(tmpl)
+	}
+}
+
+// refresh runs tmpl's query to completion and stores its result, or the
+// error that prevented that, replacing whatever was cached before.
+func (c *templateCache) refresh(tmpl queryTemplate) {
+	result := &cachedResult{UpdatedAt: time.Now()}
+
+	var profile *sqlagent.Profile
+
+	if tmpl.Profile != "" {
+		var ok bool
+
+		profile, ok = sqlagent.GetProfile(sqlagent.DefaultTenant, tmpl.Profile)
+		if !ok {
+			result.Err = fmt.Sprintf("unknown profile: %v", tmpl.Profile)
+			c.store(tmpl.Name, result)
+			return
+		}
+	}
+
+	driver := tmpl.Driver
+	connection := map[string]interface{}(nil)
+
+	if profile != nil {
+		if driver == "" {
+			driver = profile.Driver
+		}
+
+		connection = profile.Connection
+	}
+
+	db, err := sqlagent.PersistentConnectProfile(profile, driver, connection)
+	if err != nil {
+		result.Err = fmt.Sprintf("problem connecting to database: %s", err)
+		c.store(tmpl.Name, result)
+		return
+	}
+
+	iter, err := sqlagent.ExecuteProfile(profile, db, tmpl.SQL, tmpl.Params)
+	if err != nil {
+		result.Err = fmt.Sprintf("error executing query: %s", err)
+		c.store(tmpl.Name, result)
+		return
+	}
+
+	defer iter.Close()
+
+	result.Columns = iter.Cols
+	sig := schemaSignature{Columns: iter.Cols, Types: iter.ColTypes}
+
+	for iter.Next() {
+		row := make(sqlagent.Record)
+
+		if err := iter.Scan(row); err != nil {
+			result.Err = fmt.Sprintf("error reading results: %s", err)
+			c.store(tmpl.Name, result)
+			return
+		}
+
+		result.Rows = append(result.Rows, row)
+	}
+
+	if drift := c.checkDrift(tmpl.Name, sig); drift != "" {
+		warning := fmt.Sprintf("schema drift detected: %s", drift)
+		log.Printf("query cache: template %q: %s", tmpl.Name, warning)
+
+		if tmpl.OnDrift == "fail" {
+			// Reject the new shape outright, leaving whatever was already
+			// cached (still matching the established schema) in place for
+			// GET /cache/{name} instead of handing consumers a result that
+			// would break their loaders.
+			return
+		}
+
+		result.SchemaDriftWarning = warning
+	}
+
+	c.recordSchema(tmpl.Name, sig)
+	c.store(tmpl.Name, result)
+
+	log.Printf("query cache: refreshed template %q (%d rows)", tmpl.Name, len(result.Rows))
+}
+
+// checkDrift compares sig against the schema recorded for name by the last
+// successful refresh, returning a description of how they differ, or "" if
+// they match or no prior schema has been recorded yet.
+func (c *templateCache) checkDrift(name string, sig schemaSignature) string {
+	c.mu.RLock()
+	prev, ok := c.schemas[name]
+	c.mu.RUnlock()
+
+	if !ok {
+		return ""
+	}
+
+	return prev.diff(sig)
+}
+
+func (c *templateCache) recordSchema(name string, sig schemaSignature) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.schemas[name] = sig
+}
+
+func (c *templateCache) store(name string, result *cachedResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.results[name] = result
+}
+
+func (c *templateCache) get(name string) (*cachedResult, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	r, ok := c.results[name]
+	return r, ok
+}
+
+// invalidateName forces an immediate re-materialization of one named
+// template, reporting whether that template exists.
+func (c *templateCache) invalidateName(name string) bool {
+	c.mu.RLock()
+	tmpl, ok := c.templates[name]
+	c.mu.RUnlock()
+
+	if !ok {
+		return false
+	}
+
+	go c.refresh(tmpl)
+
+	return true
+}
+
+// invalidateTag forces an immediate re-materialization of every template
+// carrying tag, returning how many templates matched.
+func (c *templateCache) invalidateTag(tag string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	n := 0
+
+	for _, tmpl := range c.templates {
+		for _, t := range tmpl.Tags {
+			if t == tag {
+				go c.refresh(tmpl)
+				n++
+				break
+			}
+		}
+	}
+
+	return n
+}
+
+// handleCacheGet serves GET /cache/{name}, returning the most recently
+// materialized result for a registered template query.
+func handleCacheGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if queryCache == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		w.Write([]byte("query cache is not enabled; set -query-cache-templates"))
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/cache/")
+	if name == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	result, ok := queryCache.get(name)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(fmt.Sprintf("unknown or not-yet-materialized template: %v", name)))
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleCacheInvalidate serves POST /cache/invalidate, forcing an
+// immediate re-materialization of one template by name, or of every
+// template carrying a given tag.
+func handleCacheInvalidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if queryCache == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		w.Write([]byte("query cache is not enabled; set -query-cache-templates"))
+		return
+	}
+
+	var body struct {
+		Name string `json:"name"`
+		Tag  string `json:"tag"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte(fmt.Sprintf("could not decode JSON: %s", err)))
+		return
+	}
+
+	switch {
+	case body.Name != "":
+		if !queryCache.invalidateName(body.Name) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(fmt.Sprintf("unknown template: %v", body.Name)))
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+
+	case body.Tag != "":
+		n := queryCache.invalidateTag(body.Tag)
+
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"invalidated": n})
+
+	default:
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte("missing \"name\" or \"tag\" field"))
+	}
+}
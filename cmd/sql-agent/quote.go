@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// quotePayload is the body of a POST /quote request.
+type quotePayload struct {
+	Driver      string        `json:"driver"`
+	Identifiers []string      `json:"identifiers"`
+	Literals    []interface{} `json:"literals"`
+}
+
+// quoteResponse reports the quoted identifiers/literals along with the
+// driver's placeholder style and identifier length limit, so clients
+// building dynamic SQL stop guessing at backend-specific syntax.
+type quoteResponse struct {
+	Identifiers         []string `json:"identifiers"`
+	Literals            []string `json:"literals"`
+	Placeholder         string   `json:"placeholder"`
+	MaxIdentifierLength int      `json:"max_identifier_length"`
+}
+
+// handleQuote serves POST /quote, a small dialect service that quotes
+// identifiers, formats literals, and reports placeholder/limit information
+// for a given driver.
+func handleQuote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload quotePayload
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte("could not decode JSON: " + err.Error()))
+		return
+	}
+
+	internal, ok := sqlagent.Drivers[payload.Driver]
+	if !ok {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte("unknown driver: " + payload.Driver))
+		return
+	}
+
+	dialect, ok := sqlagent.Dialects[internal]
+	if !ok {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte("unknown driver: " + payload.Driver))
+		return
+	}
+
+	resp := quoteResponse{
+		Placeholder:         dialect.Placeholder,
+		MaxIdentifierLength: dialect.MaxIdentifierLength,
+	}
+
+	for _, ident := range payload.Identifiers {
+		quoted, _ := sqlagent.QuoteIdentifier(internal, ident)
+		resp.Identifiers = append(resp.Identifiers, quoted)
+	}
+
+	for _, lit := range payload.Literals {
+		quoted, _ := sqlagent.QuoteLiteral(internal, lit)
+		resp.Literals = append(resp.Literals, quoted)
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"expvar"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// routeTargets counts connections routed to each host by
+// sqlagent.RouteObserver, for profiles using latency-based "hosts" routing.
+var routeTargets = expvar.NewMap("route_targets")
+
+func init() {
+	sqlagent.RouteObserver = func(host string) {
+		routeTargets.Add(host, 1)
+	}
+}
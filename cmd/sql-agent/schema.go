@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+)
+
+// requestSchema is the JSON Schema for the query request payload. It is
+// published at GET /schema so clients can validate requests before sending
+// them, and mirrors the fields strict mode enforces server-side.
+const requestSchema = `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"title": "SQL Agent request",
+	"type": "object",
+	"properties": {
+		"driver": {"type": "string"},
+		"connection": {"type": "object"},
+		"profile": {"type": "string"},
+		"sql": {"type": "string"},
+		"params": {"type": "object"},
+		"materialize": {"type": "string"},
+		"buffer": {"type": "boolean"},
+		"select": {"type": "array", "items": {"type": "string"}},
+		"rename": {"type": "object"},
+		"flatten": {"type": "boolean"},
+		"case": {"type": "string", "enum": ["", "lower", "camel"]},
+		"snapshot": {"type": "string", "format": "date-time"},
+		"page_size": {"type": "integer"},
+		"page_offset": {"type": "integer"},
+		"sort_key": {"type": "string"},
+		"after": {},
+		"export": {"type": "boolean"},
+		"multi_statement": {"type": "boolean"},
+		"deterministic": {"type": "boolean"}
+	},
+	"required": ["sql"],
+	"additionalProperties": false
+}`
+
+// handleSchema serves GET /schema, the published JSON Schema for request bodies.
+func handleSchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("content-type", "application/schema+json")
+	w.Write([]byte(requestSchema))
+}
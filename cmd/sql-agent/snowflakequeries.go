@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// handleSnowflakeQueryStatus serves GET /snowflake/queries/{queryID}?profile=...,
+// looking up a previously run query's status by the ID reported in the
+// X-Snowflake-Query-ID trailer of its original response, so a client that
+// lost that response (or wants to correlate with Snowflake's own
+// QUERY_HISTORY) can check what happened to it. It only reports status, not
+// result rows; see sqlagent.QueryStatus.
+func handleSnowflakeQueryStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	queryID := strings.TrimPrefix(r.URL.Path, "/snowflake/queries/")
+	if queryID == "" || queryID == r.URL.Path {
+		writeError(w, StatusUnprocessableEntity, "missing query ID")
+		return
+	}
+
+	profileName := r.URL.Query().Get("profile")
+	if profileName == "" {
+		writeError(w, StatusUnprocessableEntity, "profile query parameter is required")
+		return
+	}
+
+	tenant, ok := tenantFor(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unknown API key")
+		return
+	}
+
+	profile, ok := sqlagent.GetProfile(tenant, profileName)
+	if !ok {
+		writeError(w, StatusUnprocessableEntity, "unknown profile: "+profileName)
+		return
+	}
+
+	if profile.Driver != "snowflake" {
+		writeError(w, StatusUnprocessableEntity, "profile "+profileName+" is not a snowflake profile")
+		return
+	}
+
+	db, err := sqlagent.PersistentConnectProfile(profile, profile.Driver, profile.Connection)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "problem connecting to database: "+err.Error())
+		return
+	}
+
+	status, err := sqlagent.QueryStatus(db, queryID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "problem fetching query status: "+err.Error())
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// apiKeyTenants maps an API key to the tenant namespace it authenticates
+// as. A nil map means tenancy is disabled and every request shares the
+// single default namespace, preserving prior single-tenant behavior.
+var apiKeyTenants map[string]string
+
+// tenantRequests counts requests per tenant for the admin metrics endpoint.
+var tenantRequests = expvar.NewMap("tenant_requests")
+
+// loadAPIKeys reads a JSON file mapping API key to tenant name.
+func loadAPIKeys(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, &apiKeyTenants)
+}
+
+// tenantFor resolves the tenant namespace for a request from its
+// X-Api-Key header. When no API keys are configured, every request is
+// served from sqlagent.DefaultTenant.
+func tenantFor(r *http.Request) (string, bool) {
+	if apiKeyTenants == nil {
+		return sqlagent.DefaultTenant, true
+	}
+
+	key := r.Header.Get("X-Api-Key")
+
+	tenant, ok := apiKeyTenants[key]
+	if !ok {
+		return "", false
+	}
+
+	tenantRequests.Add(tenant, 1)
+
+	return tenant, true
+}
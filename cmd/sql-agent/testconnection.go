@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// testConnectionPayload is the body of a POST /test-connection request.
+type testConnectionPayload struct {
+	Driver     string                 `json:"driver"`
+	Connection map[string]interface{} `json:"connection"`
+}
+
+// testConnectionResponse reports the outcome of a connection test.
+type testConnectionResponse struct {
+	Version string  `json:"version"`
+	Latency float64 `json:"latency_ms"`
+}
+
+// handleTestConnection serves POST /test-connection, validating a
+// connection spec by opening a connection, running a driver-appropriate
+// probe query, and reporting the server version and round-trip latency.
+// The connection is never added to the persistent pool.
+func handleTestConnection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload testConnectionPayload
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte("could not decode JSON: " + err.Error()))
+		return
+	}
+
+	if _, ok := sqlagent.Drivers[payload.Driver]; !ok {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte("unknown driver: " + payload.Driver))
+		return
+	}
+
+	result, err := sqlagent.TestConnection(payload.Driver, payload.Connection)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("problem connecting to database: " + err.Error()))
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(testConnectionResponse{
+		Version: result.Version,
+		Latency: float64(result.Latency) / float64(1e6),
+	})
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"sort"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// uiHistoryLimit bounds how many recent history records GET /ui/data reads
+// from SQLite to build its recent-errors, slow-queries, and per-driver
+// panels, so a busy deployment with history enabled doesn't turn every
+// dashboard refresh into a full table scan.
+const uiHistoryLimit = 500
+
+// uiPool is one profile's row in the dashboard's pool status panel.
+type uiPool struct {
+	Name           string  `json:"name"`
+	Driver         string  `json:"driver"`
+	MaxConcurrency int     `json:"max_concurrency"`
+	AvgWaitSeconds float64 `json:"avg_wait_seconds"`
+	ExhaustedTotal int64   `json:"exhausted_total"`
+}
+
+// uiDriver is one row in the dashboard's driver availability panel.
+type uiDriver struct {
+	Public    string `json:"public"`
+	Internal  string `json:"internal"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// uiDriverStats is one row in the dashboard's per-driver metrics panel,
+// aggregated from the last uiHistoryLimit history records.
+type uiDriverStats struct {
+	Driver            string  `json:"driver"`
+	Queries           int     `json:"queries"`
+	Errors            int     `json:"errors"`
+	AvgDurationSecond float64 `json:"avg_duration_seconds"`
+}
+
+// uiData is the JSON shape served by GET /ui/data and rendered by GET /ui.
+type uiData struct {
+	ActiveQueries  []*activeQuery  `json:"active_queries"`
+	Pools          []uiPool        `json:"pools"`
+	Drivers        []uiDriver      `json:"drivers"`
+	HistoryEnabled bool            `json:"history_enabled"`
+	RecentErrors   []historyRecord `json:"recent_errors,omitempty"`
+	SlowQueries    []historyRecord `json:"slow_queries,omitempty"`
+	DriverStats    []uiDriverStats `json:"driver_stats,omitempty"`
+}
+
+// expvarFloat reads the value of an expvar.Map entry added via AddFloat,
+// returning 0 if it doesn't exist or isn't a float.
+func expvarFloat(m *expvar.Map, key string) float64 {
+	v, ok := m.Get(key).(*expvar.Float)
+	if !ok {
+		return 0
+	}
+
+	return v.Value()
+}
+
+// expvarInt reads the value of an expvar.Map entry added via Add,
+// returning 0 if it doesn't exist or isn't an int.
+func expvarInt(m *expvar.Map, key string) int64 {
+	v, ok := m.Get(key).(*expvar.Int)
+	if !ok {
+		return 0
+	}
+
+	return v.Value()
+}
+
+// buildUIData assembles the current snapshot for the dashboard.
+func buildUIData() uiData {
+	data := uiData{
+		ActiveQueries: snapshotActiveQueries(),
+	}
+
+	profiles := sqlagent.ListProfiles(sqlagent.DefaultTenant)
+	poolNames := make([]string, 0, len(profiles))
+	for name := range profiles {
+		poolNames = append(poolNames, name)
+	}
+	sort.Strings(poolNames)
+
+	for _, name := range poolNames {
+		p := profiles[name]
+
+		count := expvarInt(poolWaitCount, name)
+		avgWait := 0.0
+		if count > 0 {
+			avgWait = expvarFloat(poolWaitSeconds, name) / float64(count)
+		}
+
+		data.Pools = append(data.Pools, uiPool{
+			Name:           name,
+			Driver:         p.Driver,
+			MaxConcurrency: p.EffectiveMaxConcurrency(),
+			AvgWaitSeconds: avgWait,
+			ExhaustedTotal: expvarInt(poolExhaustedTotal, name),
+		})
+	}
+
+	publicNames := make([]string, 0, len(sqlagent.Drivers))
+	for name := range sqlagent.Drivers {
+		publicNames = append(publicNames, name)
+	}
+	sort.Strings(publicNames)
+
+	for _, name := range publicNames {
+		internal := sqlagent.Drivers[name]
+		reason, unavailable := sqlagent.UnavailableReason(internal)
+
+		data.Drivers = append(data.Drivers, uiDriver{
+			Public:    name,
+			Internal:  internal,
+			Available: !unavailable,
+			Reason:    reason,
+		})
+	}
+
+	if history == nil {
+		return data
+	}
+
+	data.HistoryEnabled = true
+
+	recent, err := history.Recent(uiHistoryLimit)
+	if err != nil {
+		return data
+	}
+
+	stats := make(map[string]*uiDriverStats)
+
+	for _, r := range recent {
+		if r.Status == "error" && len(data.RecentErrors) < 20 {
+			data.RecentErrors = append(data.RecentErrors, r)
+		}
+
+		s, ok := stats[r.Driver]
+		if !ok {
+			s = &uiDriverStats{Driver: r.Driver}
+			stats[r.Driver] = s
+		}
+
+		s.Queries++
+		if r.Status == "error" {
+			s.Errors++
+		}
+		s.AvgDurationSecond += r.Duration
+	}
+
+	driverNames := make([]string, 0, len(stats))
+	for name, s := range stats {
+		if s.Queries > 0 {
+			s.AvgDurationSecond /= float64(s.Queries)
+		}
+		driverNames = append(driverNames, name)
+	}
+	sort.Strings(driverNames)
+
+	for _, name := range driverNames {
+		data.DriverStats = append(data.DriverStats, *stats[name])
+	}
+
+	slow := append([]historyRecord(nil), recent...)
+	sort.Slice(slow, func(i, j int) bool { return slow[i].Duration > slow[j].Duration })
+
+	if len(slow) > 20 {
+		slow = slow[:20]
+	}
+	data.SlowQueries = slow
+
+	return data
+}
+
+// handleUIData serves GET /ui/data, the JSON the dashboard polls.
+func handleUIData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(buildUIData())
+}
+
+// uiPage is the dashboard itself: a single static HTML document that polls
+// GET /ui/data. It is embedded as a Go string rather than a separate asset
+// (and the packaging that would require) since this project has no static
+// asset pipeline; see cmd/sql-agent/admin.go for the auth boundary it's
+// served behind.
+const uiPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>sql-agent</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h2 { margin-top: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #ddd; font-size: 0.9em; }
+th { background: #f5f5f5; }
+.unavailable { color: #a00; }
+.available { color: #080; }
+code { font-size: 0.85em; }
+</style>
+</head>
+<body>
+<h1>sql-agent</h1>
+<p>Read-only operational dashboard. Refreshes every 5 seconds.</p>
+
+<h2>Live queries</h2>
+<table id="active"><thead><tr><th>Profile</th><th>Driver</th><th>Client</th><th>Started</th><th>SQL</th></tr></thead><tbody></tbody></table>
+
+<h2>Pool status</h2>
+<table id="pools"><thead><tr><th>Profile</th><th>Driver</th><th>Max concurrency</th><th>Avg acquire wait (s)</th><th>Exhausted</th></tr></thead><tbody></tbody></table>
+
+<h2>Drivers</h2>
+<table id="drivers"><thead><tr><th>Driver</th><th>Internal</th><th>Status</th></tr></thead><tbody></tbody></table>
+
+<h2>Per-driver metrics</h2>
+<table id="driverstats"><thead><tr><th>Driver</th><th>Queries</th><th>Errors</th><th>Avg duration (s)</th></tr></thead><tbody></tbody></table>
+
+<h2>Recent errors</h2>
+<table id="errors"><thead><tr><th>Driver</th><th>When</th><th>Client</th><th>Fingerprint</th></tr></thead><tbody></tbody></table>
+
+<h2>Slow queries</h2>
+<table id="slow"><thead><tr><th>Driver</th><th>Duration (s)</th><th>When</th><th>Fingerprint</th></tr></thead><tbody></tbody></table>
+
+<script>
+function cell(text) { var td = document.createElement("td"); td.textContent = text; return td; }
+
+function renderRows(tableID, rows, makeCells) {
+  var tbody = document.querySelector("#" + tableID + " tbody");
+  tbody.innerHTML = "";
+  (rows || []).forEach(function(row) {
+    var tr = document.createElement("tr");
+    makeCells(row).forEach(function(c) { tr.appendChild(c); });
+    tbody.appendChild(tr);
+  });
+}
+
+function refresh() {
+  fetch("/ui/data").then(function(resp) { return resp.json(); }).then(function(data) {
+    renderRows("active", data.active_queries, function(q) {
+      return [cell(q.profile), cell(q.driver), cell(q.client), cell(q.started_at), cell(q.sql)];
+    });
+    renderRows("pools", data.pools, function(p) {
+      return [cell(p.name), cell(p.driver), cell(p.max_concurrency), cell(p.avg_wait_seconds.toFixed(3)), cell(p.exhausted_total)];
+    });
+    renderRows("drivers", data.drivers, function(d) {
+      var status = cell(d.available ? "available" : "unavailable: " + d.reason);
+      status.className = d.available ? "available" : "unavailable";
+      return [cell(d.public), cell(d.internal), status];
+    });
+    renderRows("driverstats", data.driver_stats, function(s) {
+      return [cell(s.driver), cell(s.queries), cell(s.errors), cell(s.avg_duration_seconds.toFixed(3))];
+    });
+    renderRows("errors", data.recent_errors, function(e) {
+      return [cell(e.driver), cell(e.ran_at), cell(e.client), cell(e.fingerprint)];
+    });
+    renderRows("slow", data.slow_queries, function(q) {
+      return [cell(q.driver), cell(q.duration.toFixed(3)), cell(q.ran_at), cell(q.fingerprint)];
+    });
+  });
+}
+
+refresh();
+setInterval(refresh, 5000);
+</script>
+</body>
+</html>
+`
+
+// handleUI serves GET /ui, the dashboard page itself.
+func handleUI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	w.Write([]byte(uiPage))
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/chop-dbhi/sql-agent"
+)
+
+// maxUploadSize bounds the in-memory portion of a parsed multipart upload;
+// larger files spill to temp files via the standard multipart reader.
+const maxUploadSize = 32 << 20 // 32MiB
+
+// uploadStatementReport is the per-statement outcome of a POST /exec-upload
+// request, including the statement text so a failure can be traced back to
+// the line(s) of the uploaded file that produced it.
+type uploadStatementReport struct {
+	SQL          string `json:"sql"`
+	RowsAffected int64  `json:"rows_affected"`
+	Error        string `json:"error,omitempty"`
+}
+
+// uploadResponse is the body of a POST /exec-upload response.
+type uploadResponse struct {
+	Statements []uploadStatementReport `json:"statements"`
+	Committed  bool                    `json:"committed"`
+}
+
+// handleSQLUpload serves POST /exec-upload, accepting a multipart/form-data
+// upload of a `.sql` file. The file is split into statements with a
+// dialect-aware splitter and executed as a batch (see ExecBatch), so schema
+// deploy scripts can be run in one request instead of being chopped up by
+// the client.
+//
+// Besides the `file` part, the form accepts the same `driver`, `profile`,
+// `connection` (JSON-encoded), and `tolerant` fields as POST /exec-batch.
+func handleSQLUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenant, ok := tenantFor(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("unknown or missing API key"))
+		return
+	}
+
+	if quotaExceeded(r.Header.Get("X-Api-Key"), time.Now()) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("usage quota exceeded"))
+		return
+	}
+
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte(fmt.Sprintf("could not parse upload: %s", err)))
+		return
+	}
+
+	driver := r.FormValue("driver")
+	profileName := r.FormValue("profile")
+	tolerant := r.FormValue("tolerant") == "true"
+
+	var connection map[string]interface{}
+
+	if c := r.FormValue("connection"); c != "" {
+		if err := json.Unmarshal([]byte(c), &connection); err != nil {
+			w.WriteHeader(StatusUnprocessableEntity)
+			w.Write([]byte(fmt.Sprintf("could not decode connection: %s", err)))
+			return
+		}
+	}
+
+	var profile *sqlagent.Profile
+
+	if profileName != "" {
+		var ok bool
+
+		profile, ok = sqlagent.GetProfile(tenant, profileName)
+		if !ok {
+			w.WriteHeader(StatusUnprocessableEntity)
+			w.Write([]byte(fmt.Sprintf("unknown profile: %v", profileName)))
+			return
+		}
+
+		if driver == "" {
+			driver = profile.Driver
+		}
+
+		if connection == nil {
+			connection = profile.Connection
+		}
+	}
+
+	if _, ok := sqlagent.Drivers[driver]; !ok {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte(fmt.Sprintf("unknown driver: %v", driver)))
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		w.WriteHeader(StatusUnprocessableEntity)
+		w.Write([]byte("missing \"file\" upload"))
+		return
+	}
+	defer file.Close()
+
+	contents, err := ioutil.ReadAll(file)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(fmt.Sprintf("error reading upload: %s", err)))
+		return
+	}
+
+	internal := sqlagent.Drivers[driver]
+	stmts := sqlagent.SplitStatements(internal, string(contents))
+
+	for _, s := range stmts {
+		if warnings := sqlagent.Lint(s); len(warnings) > 0 && profile.EffectiveLintMode() == "block" {
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": "query blocked by lint policy", "warnings": warnings})
+			return
+		}
+
+		if err := profile.CheckMaintenance(s, time.Now()); err != nil {
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error(), "code": "profile_in_maintenance"})
+			return
+		}
+	}
+
+	db, err := sqlagent.PersistentConnectProfile(profile, driver, connection)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(fmt.Sprintf("problem connecting to database: %s", err)))
+		return
+	}
+
+	if err := profile.Acquire(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(fmt.Sprintf("problem acquiring a connection slot: %s", err)))
+		return
+	}
+	defer profile.Release()
+
+	ctx := context.Background()
+
+	if timeout := profile.EffectiveTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	batch := make([]sqlagent.BatchStatement, len(stmts))
+	for i, s := range stmts {
+		batch[i] = sqlagent.BatchStatement{SQL: s}
+	}
+
+	results, execErr := sqlagent.ExecBatch(ctx, db, internal, batch, tolerant)
+
+	report := make([]uploadStatementReport, len(results))
+	for i, res := range results {
+		report[i] = uploadStatementReport{SQL: stmts[i], RowsAffected: res.RowsAffected, Error: res.Error}
+	}
+
+	w.Header().Set("content-type", "application/json")
+
+	if execErr != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(uploadResponse{Statements: report, Committed: false})
+		return
+	}
+
+	json.NewEncoder(w).Encode(uploadResponse{Statements: report, Committed: true})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// usageLimits caps how much a single API key may consume in a day or
+// month before further requests are rejected with 429. A zero field
+// means that dimension is unlimited.
+type usageLimits struct {
+	DailyRows      int64   `json:"daily_rows"`
+	DailyBytes     int64   `json:"daily_bytes"`
+	DailySeconds   float64 `json:"daily_seconds"`
+	MonthlyRows    int64   `json:"monthly_rows"`
+	MonthlyBytes   int64   `json:"monthly_bytes"`
+	MonthlySeconds float64 `json:"monthly_seconds"`
+}
+
+// usageQuotas maps API key to its usageLimits. A nil map means no quotas
+// are configured and every request is admitted regardless of usage.
+var usageQuotas map[string]usageLimits
+
+// loadUsageQuotas reads a JSON file mapping API key to its usageLimits.
+func loadUsageQuotas(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, &usageQuotas)
+}
+
+// usagePeriod accumulates one API key's consumption over a single
+// rollup period (a calendar day or month).
+type usagePeriod struct {
+	Rows    int64   `json:"rows"`
+	Bytes   int64   `json:"bytes"`
+	Seconds float64 `json:"seconds"`
+}
+
+// usageTracker accumulates rows returned, bytes transferred, and query
+// seconds per API key, rolled up by calendar day and month (UTC), for
+// chargeback reporting via GET /usage and quota enforcement in
+// quotaExceeded. Counters live in memory only, the same tradeoff made by
+// the existing tenantRequests and routeTargets expvar counters
+// elsewhere in this package: a restart resets usage, which is accepted
+// for this class of metric in this agent.
+type usageTracker struct {
+	mu      sync.Mutex
+	daily   map[string]*usagePeriod
+	monthly map[string]*usagePeriod
+}
+
+// apiUsage is the process-wide tracker. It is always initialized, even
+// when -usage-quotas is unset, so GET /usage reports real numbers
+// regardless of whether enforcement is enabled.
+var apiUsage = &usageTracker{
+	daily:   make(map[string]*usagePeriod),
+	monthly: make(map[string]*usagePeriod),
+}
+
+func dayKey(apiKey string, t time.Time) string {
+	return apiKey + "|" + t.UTC().Format("2006-01-02")
+}
+
+func monthKey(apiKey string, t time.Time) string {
+	return apiKey + "|" + t.UTC().Format("2006-01")
+}
+
+// record adds one request's consumption to apiKey's current day and
+// month rollups.
+func (u *usageTracker) record(apiKey string, rows int, bytes int64, seconds float64, now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.add(u.daily, dayKey(apiKey, now), rows, bytes, seconds)
+	u.add(u.monthly, monthKey(apiKey, now), rows, bytes, seconds)
+}
+
+func (u *usageTracker) add(m map[string]*usagePeriod, key string, rows int, bytes int64, seconds float64) {
+	p, ok := m[key]
+	if !ok {
+		p = &usagePeriod{}
+		m[key] = p
+	}
+
+	p.Rows += int64(rows)
+	p.Bytes += bytes
+	p.Seconds += seconds
+}
+
+// snapshot returns apiKey's current day and month rollups.
+func (u *usageTracker) snapshot(apiKey string, now time.Time) (day, month usagePeriod) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if p, ok := u.daily[dayKey(apiKey, now)]; ok {
+		day = *p
+	}
+
+	if p, ok := u.monthly[monthKey(apiKey, now)]; ok {
+		month = *p
+	}
+
+	return day, month
+}
+
+// recordUsage adds a completed request's consumption to the requesting
+// API key's usage rollups. bytes is best-effort: it is zero for response
+// modes (Materialize, MultiStatement, Export) that don't pass their
+// output through a checksumWriter.
+func recordUsage(r *http.Request, rows int, bytes int64, seconds float64) {
+	apiUsage.record(r.Header.Get("X-Api-Key"), rows, bytes, seconds, time.Now())
+}
+
+// quotaExceeded reports whether apiKey has already exhausted any quota
+// configured for it in usageQuotas, based on usage recorded so far. It
+// checks usage already on the books, not the request about to run, so a
+// request that pushes a key over its quota is still admitted; the next
+// one is rejected.
+func quotaExceeded(apiKey string, now time.Time) bool {
+	if usageQuotas == nil {
+		return false
+	}
+
+	limits, ok := usageQuotas[apiKey]
+	if !ok {
+		return false
+	}
+
+	day, month := apiUsage.snapshot(apiKey, now)
+
+	switch {
+	case limits.DailyRows > 0 && day.Rows >= limits.DailyRows:
+		return true
+	case limits.DailyBytes > 0 && day.Bytes >= limits.DailyBytes:
+		return true
+	case limits.DailySeconds > 0 && day.Seconds >= limits.DailySeconds:
+		return true
+	case limits.MonthlyRows > 0 && month.Rows >= limits.MonthlyRows:
+		return true
+	case limits.MonthlyBytes > 0 && month.Bytes >= limits.MonthlyBytes:
+		return true
+	case limits.MonthlySeconds > 0 && month.Seconds >= limits.MonthlySeconds:
+		return true
+	}
+
+	return false
+}
+
+// usageReport is the GET /usage response body.
+type usageReport struct {
+	Daily   usagePeriod  `json:"daily"`
+	Monthly usagePeriod  `json:"monthly"`
+	Limits  *usageLimits `json:"limits,omitempty"`
+}
+
+// handleUsage serves GET /usage, reporting the requesting API key's
+// current daily and monthly rollups and its configured quota, if any.
+func handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	apiKey := r.Header.Get("X-Api-Key")
+	now := time.Now()
+
+	day, month := apiUsage.snapshot(apiKey, now)
+
+	report := usageReport{Daily: day, Monthly: month}
+
+	if limits, ok := usageQuotas[apiKey]; ok {
+		report.Limits = &limits
+	}
+
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -1,7 +1,10 @@
 package sqlagent
 
 import (
+	"context"
+	dbsql "database/sql"
 	"encoding/json"
+	"errors"
 	"sync"
 	"time"
 
@@ -20,26 +23,166 @@ type Record map[string]interface{}
 // Iterator provides a lazy access to the database rows.
 type Iterator struct {
 	Cols []string
-	rows *sqlx.Rows
+
+	// ColTypes holds each column's driver-reported DatabaseTypeName, in the
+	// same order as Cols, when the underlying driver implements
+	// database/sql's ColumnTypes. Nil when it doesn't.
+	ColTypes []string
+
+	// MaxRows caps the number of rows Next will return, regardless of how
+	// many the underlying query produced. Zero means unlimited.
+	MaxRows int
+
+	rows  *sqlx.Rows
+	count int
+
+	// QueryID is the Snowflake query ID assigned to this iterator's
+	// statement, correlating it with Snowflake's own QUERY_HISTORY. It is
+	// populated by Close, once the result set has been fully read, by
+	// querying SELECT LAST_QUERY_ID() on the same reserved connection the
+	// statement ran on (see snowflakeConn and Execute); the vendored
+	// gosnowflake driver has no public API exposing it any earlier. Empty
+	// for every other driver.
+	QueryID string
+
+	// snowflakeConn, when set by Execute for the snowflake driver, is the
+	// single connection reserved for this statement's whole lifetime, so
+	// the LAST_QUERY_ID() lookup in Close reads the same session instead
+	// of a different, unrelated pooled connection.
+	snowflakeConn *dbsql.Conn
+
+	// scanKinds holds the typedScanDest/typedScanValue kind chosen for
+	// each of Cols, in the same order, when the underlying driver
+	// implements ColumnTypes. Scan uses these for typed, NULL-safe
+	// destinations instead of sqlx's reflection-based MapScan. Nil when
+	// the driver doesn't implement ColumnTypes, in which case Scan falls
+	// back to MapScan.
+	scanKinds []string
+
+	// semiStructured names the columns (Snowflake VARIANT/OBJECT/ARRAY)
+	// whose values should be decoded from JSON text during Scan.
+	semiStructured map[string]bool
+
+	// fieldOptions, if set, projects/renames/flattens/cases each record
+	// during Scan. It has no effect on ScanRow, so it does not apply to
+	// CSV output; see FieldOptions.
+	fieldOptions *FieldOptions
+
+	// transforms, if set, computes or renames columns during Scan, before
+	// fieldOptions runs. Like fieldOptions, it has no effect on ScanRow.
+	transforms Transforms
+
+	ctx context.Context
+
+	// deadlineCancel, when set by ExecuteProfile, releases the context used
+	// to bound the query itself (the statement timeout). It must stay live
+	// for as long as rows are still being read, so it's called from Close
+	// rather than as soon as Execute returns.
+	deadlineCancel context.CancelFunc
 }
 
-// Close closes the iterator.
+// SetFieldOptions applies opts to every record returned by Scan from this
+// point on.
+func (i *Iterator) SetFieldOptions(opts *FieldOptions) {
+	i.fieldOptions = opts
+}
+
+// SetTransforms applies ts, in order, to every record returned by Scan
+// from this point on, before fieldOptions runs.
+func (i *Iterator) SetTransforms(ts Transforms) {
+	i.transforms = ts
+}
+
+// SetContext ties the iterator to ctx, so Next stops fetching further rows
+// once ctx is done (e.g. the client disconnected mid-stream) instead of
+// continuing to pull the full result set into a response nobody will read.
+func (i *Iterator) SetContext(ctx context.Context) {
+	i.ctx = ctx
+}
+
+// Close closes the iterator and releases its statement-timeout context, if
+// ExecuteProfile set one. For a Snowflake iterator, it also looks up
+// QueryID and releases the connection reserved for the statement by
+// Execute.
 func (i *Iterator) Close() {
 	i.rows.Close()
+
+	if i.snowflakeConn != nil {
+		i.snowflakeConn.QueryRowContext(context.Background(), "select last_query_id()").Scan(&i.QueryID)
+		i.snowflakeConn.Close()
+	}
+
+	if i.deadlineCancel != nil {
+		i.deadlineCancel()
+	}
 }
 
-// Next returns true if another row is available.
+// RowCount returns the number of rows scanned so far.
+func (i *Iterator) RowCount() int {
+	return i.count
+}
+
+// Next returns true if another row is available, stopping early once
+// MaxRows have been returned.
 func (i *Iterator) Next() bool {
-	return i.rows.Next()
+	if i.MaxRows > 0 && i.count >= i.MaxRows {
+		return false
+	}
+
+	if i.ctx != nil && i.ctx.Err() != nil {
+		return false
+	}
+
+	if !i.rows.Next() {
+		return false
+	}
+
+	i.count++
+	return true
 }
 
-// Scan takes a record and scans the values of a row into the record.
+// Scan takes a record and scans the values of a row into the record. When
+// the driver implements ColumnTypes, each column is scanned into a typed,
+// NULL-safe destination chosen by columnScanKind (sql.NullInt64,
+// NullFloat64, NullBool, nullTime, or RawBytes/NullString) rather than
+// sqlx's reflection-based MapScan, which many drivers satisfy for numeric
+// and date columns by handing back a raw []byte - rendering, say, an INT
+// column as the string "42" instead of the number 42. Drivers that don't
+// implement ColumnTypes fall back to the old MapScan behavior.
 func (i *Iterator) Scan(r Record) error {
-	if err := i.rows.MapScan(r); err != nil {
-		return err
+	if i.scanKinds != nil {
+		if err := i.typedScan(r); err != nil {
+			return err
+		}
+	} else {
+		if err := i.rows.MapScan(r); err != nil {
+			return err
+		}
+
+		mapBytesToString(r)
+	}
+
+	if i.semiStructured != nil {
+		decodeSemiStructured(r, i.semiStructured)
+	}
+
+	extractLOBs(r)
+
+	if i.transforms != nil {
+		r = i.transforms.Apply(r)
 	}
 
-	mapBytesToString(r)
+	if i.fieldOptions != nil {
+		transformed := i.fieldOptions.Apply(r)
+
+		for k := range r {
+			delete(r, k)
+		}
+
+		for k, v := range transformed {
+			r[k] = v
+		}
+	}
 
 	return nil
 }
@@ -48,6 +191,26 @@ func (i *Iterator) ScanRow(r []interface{}) error {
 	return i.rows.Scan(r...)
 }
 
+// typedScan scans the current row into r using the per-column destinations
+// in scanKinds (see columnScanKind/typedScanDest), then unwraps each one
+// back into a plain Go value via typedScanValue.
+func (i *Iterator) typedScan(r Record) error {
+	dests := make([]interface{}, len(i.Cols))
+	for idx, kind := range i.scanKinds {
+		dests[idx] = typedScanDest(kind)
+	}
+
+	if err := i.rows.Scan(dests...); err != nil {
+		return err
+	}
+
+	for idx, col := range i.Cols {
+		r[col] = typedScanValue(i.scanKinds[idx], dests[idx])
+	}
+
+	return nil
+}
+
 // Connect connects to a database given a driver name and set of connection parameters.
 // Each database supports a different set of connection parameters, however the few
 // that are common are standardized.
@@ -67,11 +230,30 @@ func Connect(driver string, params map[string]interface{}) (*sqlx.DB, error) {
 		return nil, ErrUnknownDriver
 	}
 
+	if reason, unavailable := UnavailableReason(driver); unavailable {
+		return nil, &DriverUnavailableError{Driver: driver, Reason: reason}
+	}
+
 	// Connect to the database.
 	connector := connectors[driver]
 
 	params = cleanParams(params)
 
+	params, err := applyLocaleOptions(driver, params)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err = resolveServiceParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err = resolveLatencyRoutedParams(params)
+	if err != nil {
+		return nil, err
+	}
+
 	dsn, ok := params["dsn"].(string)
 	if !ok {
 		dsn = connector(params)
@@ -80,36 +262,188 @@ func Connect(driver string, params map[string]interface{}) (*sqlx.DB, error) {
 	return sqlx.Connect(driver, dsn)
 }
 
-// Execute takes a database instance, SQL statement, and parameters and executes the query
-// returning the resulting rows.
-func Execute(db *sqlx.DB, sql string, params map[string]interface{}) (*Iterator, error) {
+// ConnectProfile behaves like Connect, but applies the profile's (or the
+// global default) connect timeout by mapping it to the driver's own
+// connect/login timeout DSN parameter, so a down host fails fast instead of
+// hanging a request for minutes.
+func ConnectProfile(p *Profile, driver string, params map[string]interface{}) (*sqlx.DB, error) {
+	timeout := p.EffectiveConnectTimeout()
+
+	if timeout > 0 {
+		if internal, ok := Drivers[driver]; ok {
+			if cfg, ok := connectTimeoutParams[internal]; ok {
+				merged := cleanParams(params)
+
+				if _, exists := merged[cfg.key]; !exists {
+					merged[cfg.key] = cfg.value(timeout)
+				}
+
+				params = merged
+			}
+		}
+	}
+
+	return Connect(driver, params)
+}
+
+// Execute takes a database instance, SQL statement, and parameters and
+// executes the query returning the resulting rows. ctx bounds the query
+// itself, not just how long the caller waits for it: a canceled or expired
+// ctx is forwarded to the driver via QueryContext, so the database can
+// abandon server-side work instead of this goroutine merely giving up on a
+// query that keeps running regardless.
+//
+// How much of that cancellation actually reaches the server depends on the
+// driver: the vendored snowflake, oci8, and sqlite3 drivers implement
+// database/sql's QueryerContext and cancel the in-flight query themselves.
+// The vendored lib/pq, go-sql-driver/mysql, and go-mssqldb drivers don't, so
+// for those database/sql falls back to its own generic behavior: it returns
+// as soon as ctx is done and closes the underlying connection, which frees
+// this goroutine and the pool slot immediately even though the database
+// server won't notice the client went away until its next socket read
+// fails.
+func Execute(ctx context.Context, db *sqlx.DB, sql string, params map[string]interface{}) (*Iterator, error) {
 	var (
-		err  error
-		rows *sqlx.Rows
+		err           error
+		rows          *sqlx.Rows
+		snowflakeConn *dbsql.Conn
 	)
 
-	// Execute the query.
 	if params != nil && len(params) > 0 {
-		rows, err = db.NamedQuery(sql, params)
+		params, err = resolveTypedParams(params)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	isSnowflake := db.DriverName() == "snowflake"
+
+	if isSnowflake {
+		params = encodeVariantParams(params)
+
+		// Reserve a single connection for this statement's whole lifetime
+		// (instead of letting QueryContext borrow-and-return one from the
+		// pool) so Iterator.Close's follow-up SELECT LAST_QUERY_ID() runs
+		// on the exact same Snowflake session and actually sees this
+		// query.
+		snowflakeConn, err = db.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	Logger.logStatement(sql, params)
+
+	// Execute the query.
+	if snowflakeConn != nil {
+		rows, err = namedQueryConnContext(ctx, db, snowflakeConn, sql, params)
+	} else if params != nil && len(params) > 0 {
+		rows, err = namedQueryContext(ctx, db, sql, params)
 	} else {
-		rows, err = db.Queryx(sql)
+		rows, err = queryxContext(ctx, db, sql)
 	}
 
 	if err != nil {
+		if snowflakeConn != nil {
+			snowflakeConn.Close()
+		}
+
 		return nil, err
 	}
 
 	cols, err := rows.Columns()
 	if err != nil {
+		if snowflakeConn != nil {
+			snowflakeConn.Close()
+		}
+
 		return nil, err
 	}
 
-	return &Iterator{
-		Cols: cols,
-		rows: rows,
-	}, nil
+	iter := &Iterator{
+		Cols:          cols,
+		rows:          rows,
+		snowflakeConn: snowflakeConn,
+	}
+
+	// Not every vendored driver implements ColumnTypes, so this is
+	// best-effort: ColTypes and scanKinds are left nil (falling back to
+	// MapScan in Scan) rather than failing the query over something this
+	// driver doesn't report.
+	if types, err := rows.ColumnTypes(); err == nil {
+		colTypes := make([]string, len(types))
+		scanKinds := make([]string, len(types))
+
+		for i, t := range types {
+			colTypes[i] = t.DatabaseTypeName()
+			scanKinds[i] = columnScanKind(t)
+		}
+
+		iter.ColTypes = colTypes
+		iter.scanKinds = scanKinds
+
+		if isSnowflake {
+			semi := make(map[string]bool)
+
+			for _, t := range types {
+				if snowflakeSemiStructuredTypes[t.DatabaseTypeName()] {
+					semi[t.Name()] = true
+				}
+			}
+
+			if len(semi) > 0 {
+				iter.semiStructured = semi
+			}
+		}
+	}
+
+	return iter, nil
 }
 
+// ExecuteProfile runs Execute on behalf of a named profile, applying its
+// timeout, row limit, and concurrency guardrails (or the global defaults
+// when the profile leaves them unset). The timeout is enforced by deriving
+// a context.Context with a deadline and passing it straight into Execute,
+// rather than racing Execute against a separate timer: database/sql itself
+// returns as soon as that context expires, so there's no need to abandon a
+// goroutine still running the query underneath a response that's already
+// gone back to the caller.
+func ExecuteProfile(p *Profile, db *sqlx.DB, sql string, params map[string]interface{}) (*Iterator, error) {
+	if err := p.Acquire(); err != nil {
+		return nil, err
+	}
+	defer p.Release()
+
+	ctx := context.Background()
+	cancel := context.CancelFunc(func() {})
+
+	if timeout := p.EffectiveTimeout(); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	iter, err := Execute(ctx, db, sql, params)
+	if err != nil {
+		cancel()
+
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrStatementTimeout
+		}
+
+		return nil, err
+	}
+
+	iter.deadlineCancel = cancel
+	iter.MaxRows = p.EffectiveMaxRows()
+
+	return iter, nil
+}
+
+// ErrStatementTimeout is returned by ExecuteProfile when a query exceeds its
+// profile (or global default) timeout. Since the timeout is now enforced
+// via context deadline propagation into the driver (see ExecuteProfile),
+// this reflects an actual canceled query, not just an abandoned wait.
+var ErrStatementTimeout = errors.New("sqlagent: statement timeout exceeded")
+
 var (
 	connMap      = make(map[string]*sqlx.DB)
 	connMapMutex = &sync.Mutex{}
@@ -143,6 +477,82 @@ func PersistentConnect(driver string, params map[string]interface{}) (*sqlx.DB,
 	return db, nil
 }
 
+// PersistentConnectProfile behaves like PersistentConnect, but applies the
+// profile's connect timeout when establishing a new pooled connection.
+func PersistentConnectProfile(p *Profile, driver string, params map[string]interface{}) (*sqlx.DB, error) {
+	var (
+		db  *sqlx.DB
+		ok  bool
+		err error
+	)
+
+	connKey, _ := json.Marshal(params)
+	key := driver + string(connKey)
+
+	connMapMutex.Lock()
+	defer connMapMutex.Unlock()
+
+	if db, ok = connMap[key]; !ok {
+		db, err = ConnectProfile(p, driver, params)
+		if err != nil {
+			return nil, err
+		}
+
+		db.SetMaxIdleConns(MaxIdleConns)
+		db.SetConnMaxLifetime(MaxConnLifetime)
+
+		connMap[key] = db
+	}
+
+	return db, nil
+}
+
+// CredentialResolver, when set, is consulted by RotatePool to fetch fresh
+// connection parameters (typically just a rotated password) from an
+// external secrets backend before a pool is rebuilt. A nil resolver rebuilds
+// the pool against the params already on file, which still invalidates
+// stale connections even without a secrets backend wired in.
+var CredentialResolver func(driver string, params map[string]interface{}) (map[string]interface{}, error)
+
+// RotatePool rebuilds the pooled connection for driver/params: it resolves
+// fresh credentials (if a CredentialResolver is configured), dials a new
+// pool, and swaps it into the cache so subsequent callers pick it up. The
+// old pool, if one existed, is closed afterwards rather than interrupted,
+// so in-flight queries finish normally instead of being cut off mid-request.
+func RotatePool(driver string, params map[string]interface{}) (*sqlx.DB, error) {
+	oldKey, _ := json.Marshal(params)
+
+	if CredentialResolver != nil {
+		resolved, err := CredentialResolver(driver, params)
+		if err != nil {
+			return nil, err
+		}
+		params = resolved
+	}
+
+	db, err := Connect(driver, params)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxIdleConns(MaxIdleConns)
+	db.SetConnMaxLifetime(MaxConnLifetime)
+
+	newKey, _ := json.Marshal(params)
+
+	connMapMutex.Lock()
+	old, existed := connMap[driver+string(oldKey)]
+	delete(connMap, driver+string(oldKey))
+	connMap[driver+string(newKey)] = db
+	connMapMutex.Unlock()
+
+	if existed {
+		go old.Close()
+	}
+
+	return db, nil
+}
+
 // Shutdown closes all persisted database connections.
 func Shutdown() {
 	connMapMutex.Lock()
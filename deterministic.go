@@ -0,0 +1,51 @@
+package sqlagent
+
+import (
+	"fmt"
+	"sort"
+)
+
+// sortDeterministic stable-sorts rows by sortKey, breaking ties with a full
+// comparison across every other column in cols (in order) so that two runs
+// over unchanged data produce the same row order even when sortKey alone
+// doesn't distinguish every row. Values are compared as their string
+// representation, since that's the only total order available across every
+// column type a driver might report; callers wanting genuine numeric
+// ordering should already be asking the database for it via SortKey/ORDER
+// BY — this only makes ties the database left unordered reproducible.
+func sortDeterministic(cols []string, rows []Record, sortKey string) {
+	tiebreak := make([]string, 0, len(cols))
+
+	for _, c := range cols {
+		if c != sortKey {
+			tiebreak = append(tiebreak, c)
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if v := compareRecordValue(rows[i], rows[j], sortKey); v != 0 {
+			return v < 0
+		}
+
+		for _, c := range tiebreak {
+			if v := compareRecordValue(rows[i], rows[j], c); v != 0 {
+				return v < 0
+			}
+		}
+
+		return false
+	})
+}
+
+func compareRecordValue(a, b Record, col string) int {
+	av, bv := fmt.Sprint(a[col]), fmt.Sprint(b[col])
+
+	switch {
+	case av < bv:
+		return -1
+	case av > bv:
+		return 1
+	default:
+		return 0
+	}
+}
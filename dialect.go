@@ -0,0 +1,70 @@
+package sqlagent
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect describes the identifier quoting, literal formatting, and
+// placeholder conventions for a registered driver.
+type Dialect struct {
+	// QuoteOpen and QuoteClose bound a quoted identifier. Most drivers use
+	// the same character on both sides; MSSQL's bracket syntax does not.
+	QuoteOpen  string
+	QuoteClose string
+
+	// Placeholder describes how bound parameters are written in SQL text
+	// for this driver: "named" (:name), "positional" (?), or "numbered" ($1).
+	Placeholder string
+
+	// MaxIdentifierLength is the longest identifier the backend accepts.
+	// Zero means there is no documented limit.
+	MaxIdentifierLength int
+}
+
+// Dialects maps each internal driver name to its Dialect.
+var Dialects = map[string]Dialect{
+	"postgres":  {QuoteOpen: `"`, QuoteClose: `"`, Placeholder: "numbered", MaxIdentifierLength: 63},
+	"mysql":     {QuoteOpen: "`", QuoteClose: "`", Placeholder: "positional", MaxIdentifierLength: 64},
+	"sqlite3":   {QuoteOpen: `"`, QuoteClose: `"`, Placeholder: "positional", MaxIdentifierLength: 0},
+	"mssql":     {QuoteOpen: `[`, QuoteClose: `]`, Placeholder: "named", MaxIdentifierLength: 128},
+	"oci8":      {QuoteOpen: `"`, QuoteClose: `"`, Placeholder: "positional", MaxIdentifierLength: 30},
+	"snowflake": {QuoteOpen: `"`, QuoteClose: `"`, Placeholder: "positional", MaxIdentifierLength: 255},
+}
+
+// ErrUnknownDialect is returned when a dialect is requested for a driver
+// with none registered.
+var ErrUnknownDialect = errors.New("sqlagent: unknown dialect")
+
+// QuoteIdentifier quotes ident using driver's dialect, doubling any embedded
+// closing-quote characters.
+func QuoteIdentifier(driver, ident string) (string, error) {
+	d, ok := Dialects[driver]
+	if !ok {
+		return "", ErrUnknownDialect
+	}
+
+	escaped := strings.Replace(ident, d.QuoteClose, d.QuoteClose+d.QuoteClose, -1)
+
+	return d.QuoteOpen + escaped + d.QuoteClose, nil
+}
+
+// QuoteLiteral formats v as a SQL literal for driver.
+func QuoteLiteral(driver string, v interface{}) (string, error) {
+	if _, ok := Dialects[driver]; !ok {
+		return "", ErrUnknownDialect
+	}
+
+	switch x := v.(type) {
+	case nil:
+		return "NULL", nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(x), nil
+	default:
+		return "'" + strings.Replace(fmt.Sprint(x), "'", "''", -1) + "'", nil
+	}
+}
@@ -0,0 +1,51 @@
+package sqlagent
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// srvPrefix marks a `host` connection parameter as a DNS SRV lookup rather
+// than a literal hostname.
+const srvPrefix = "srv:"
+
+// resolveServiceParams rewrites a `host` of the form "srv:_service._proto.name"
+// into the host and port of the lowest-priority, highest-weight record
+// returned by the lookup. This covers both plain DNS SRV records and
+// Consul-registered services, since Consul's own DNS interface answers the
+// same SRV queries for ".service.consul" names. Params without a `srv:`
+// host are returned unchanged.
+//
+// The lookup happens each time a pool is created (see Connect and
+// ConnectProfile), so a new connection picks up a failover without
+// requiring a config change, though connections already open in a pool
+// keep the target they were dialed with until the pool is recreated.
+func resolveServiceParams(params map[string]interface{}) (map[string]interface{}, error) {
+	host, ok := params["host"].(string)
+	if !ok || !strings.HasPrefix(host, srvPrefix) {
+		return params, nil
+	}
+
+	name := strings.TrimPrefix(host, srvPrefix)
+
+	_, addrs, err := net.LookupSRV("", "", name)
+	if err != nil {
+		return nil, fmt.Errorf("sqlagent: resolving %s: %s", host, err)
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("sqlagent: no SRV records found for %s", host)
+	}
+
+	resolved := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		resolved[k] = v
+	}
+
+	target := addrs[0]
+	resolved["host"] = strings.TrimSuffix(target.Target, ".")
+	resolved["port"] = int(target.Port)
+
+	return resolved, nil
+}
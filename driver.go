@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Connector takes a map of connection parameters and converts them into a
@@ -109,6 +111,15 @@ var connectors = map[string]connector{
 
 	// SQLite3 requires the path and supports other query parameters.
 	// See http://godoc.org/github.com/mattn/go-sqlite3#SQLiteDriver.Open
+	//
+	// "journal_mode", "foreign_keys", and "extensions" are translated to
+	// the "_journal_mode", "_foreign_keys", and "_extensions" query
+	// parameters that cmd/sql-agent's tunedSQLiteDriver applies on every
+	// opened connection, since the stock driver only understands
+	// "_busy_timeout" (also supported here as "busy_timeout" for the same
+	// reason) natively. "extensions" names one or more operator-vetted
+	// extensions (see -sqlite-extensions), not a filesystem path, so a
+	// request body can never point LoadExtension at an arbitrary library.
 	"sqlite3": func(params map[string]interface{}) string {
 		var (
 			db    interface{} = ":memory:"
@@ -116,9 +127,18 @@ var connectors = map[string]connector{
 		)
 
 		for k, v := range params {
-			if k == "database" {
+			switch k {
+			case "database":
 				db = v
-			} else {
+			case "busy_timeout":
+				query = append(query, fmt.Sprintf("_busy_timeout=%s", url.QueryEscape(fmt.Sprint(v))))
+			case "journal_mode":
+				query = append(query, fmt.Sprintf("_journal_mode=%s", url.QueryEscape(fmt.Sprint(v))))
+			case "foreign_keys":
+				query = append(query, fmt.Sprintf("_foreign_keys=%s", url.QueryEscape(fmt.Sprint(v))))
+			case "extensions":
+				query = append(query, fmt.Sprintf("_extensions=%s", url.QueryEscape(joinSQLiteExtensionNames(v))))
+			default:
 				query = append(query, fmt.Sprintf("%s=%s", k, url.QueryEscape(fmt.Sprint(v))))
 			}
 		}
@@ -212,6 +232,103 @@ var connectors = map[string]connector{
 		return conn
 	},
 
+	// Firebird uses a URL-style DSN; a `charset` parameter (e.g. UTF8) is
+	// passed through as a query parameter, since mismatched client/database
+	// charsets are the most common source of mangled CHAR/VARCHAR data.
+	// See https://github.com/nakagami/firebirdsql#connection-string
+	//
+	// Only built when compiled with the "firebird" build tag; see
+	// cmd/sql-agent/firebird.go.
+	//
+	// DECIMAL/NUMERIC columns arrive as float64 and TIMESTAMP columns as
+	// time.Time, same as the other drivers; scale-sensitive DECIMAL values
+	// should be cast to VARCHAR in the query if exact precision matters,
+	// since the wire protocol itself does not carry scale information
+	// needed to reconstruct it losslessly.
+	"firebirdsql": func(params map[string]interface{}) string {
+		var (
+			user, pass, db interface{}
+
+			host interface{} = "localhost"
+			port interface{} = 3050
+
+			query []string
+		)
+
+		for k, v := range params {
+			switch k {
+			case "user":
+				user = v
+			case "password":
+				pass = v
+			case "host":
+				host = v
+			case "port":
+				port = v
+			case "database":
+				db = v
+			default:
+				query = append(query, fmt.Sprintf("%s=%s", k, url.QueryEscape(fmt.Sprint(v))))
+			}
+		}
+
+		var conn string
+
+		if user != nil {
+			conn += fmt.Sprintf("%s", user)
+		}
+
+		if pass != nil {
+			conn += fmt.Sprintf(":%s", pass)
+		}
+
+		if conn != "" {
+			conn += "@"
+		}
+
+		conn += fmt.Sprintf("%s:%v", host, port)
+		conn += fmt.Sprintf("/%v", db)
+
+		if len(query) > 0 {
+			conn += fmt.Sprintf("?%s", strings.Join(query, "&"))
+		}
+
+		return conn
+	},
+
+	// Informix, via IBM's combined DB2/Informix driver, uses semicolon
+	// delimited key=value pairs. Only built when compiled with the
+	// "informix" build tag; see cmd/sql-agent/informix.go.
+	// See https://github.com/ibmdb/go_ibm_db
+	"go_ibm_db": func(params map[string]interface{}) string {
+		toks := make([]string, len(params))
+		i := 0
+
+		for k, v := range params {
+			toks[i] = fmt.Sprintf("%s=%v", k, v)
+			i++
+		}
+
+		return strings.Join(toks, ";")
+	},
+
+	// ODBC passes the connection map straight through as semicolon
+	// delimited connection string attributes, since the attributes an
+	// installed ODBC DSN understands (DRIVER, SERVER, UID, PWD, and
+	// anything backend-specific) vary by driver manager.
+	// See https://github.com/alexbrainman/odbc
+	"odbc": func(params map[string]interface{}) string {
+		toks := make([]string, len(params))
+		i := 0
+
+		for k, v := range params {
+			toks[i] = fmt.Sprintf("%s=%v", k, v)
+			i++
+		}
+
+		return strings.Join(toks, ";")
+	},
+
 	// Snowflake supports space-delimited key=value pairs.
 	// See https://github.com/snowflakedb/gosnowflake#dsn-data-source-name
 	"snowflake": func(params map[string]interface{}) string {
@@ -272,6 +389,50 @@ var connectors = map[string]connector{
 	},
 }
 
+// connectTimeoutParam describes, for a single driver, the DSN parameter
+// used to bound how long connecting (logging in) may take, distinct from
+// how long a query itself may run.
+type connectTimeoutParam struct {
+	key   string
+	value func(time.Duration) interface{}
+}
+
+// connectTimeoutParams maps each internal driver name to its login/connect
+// timeout parameter. Drivers without a documented connect timeout (sqlite3,
+// oci8) are absent, so the timeout is simply not applied for them.
+var connectTimeoutParams = map[string]connectTimeoutParam{
+	// See http://godoc.org/github.com/lib/pq#hdr-Connection_String_Parameters
+	"postgres": {"connect_timeout", func(d time.Duration) interface{} { return int(d.Seconds()) }},
+
+	// See https://github.com/go-sql-driver/mysql/#timeout
+	"mysql": {"timeout", func(d time.Duration) interface{} { return d.String() }},
+
+	// See https://github.com/denisenkom/go-mssqldb#connection-parameters-and-dsn
+	"mssql": {"connection timeout", func(d time.Duration) interface{} { return int(d.Seconds()) }},
+
+	// See https://github.com/snowflakedb/gosnowflake#dsn-data-source-name
+	"snowflake": {"loginTimeout", func(d time.Duration) interface{} { return int(d.Seconds()) }},
+}
+
+// joinSQLiteExtensionNames normalizes a sqlite3 connection's "extensions"
+// value, which arrives as []interface{} of strings once decoded from a
+// JSON request body, into the comma-separated list the "_extensions"
+// query parameter carries.
+func joinSQLiteExtensionNames(v interface{}) string {
+	switch x := v.(type) {
+	case []interface{}:
+		names := make([]string, len(x))
+		for i, e := range x {
+			names[i] = fmt.Sprint(e)
+		}
+		return strings.Join(names, ",")
+	case []string:
+		return strings.Join(x, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
 // mapBytesToString ensures byte slices that were returned from the database
 // are represented as strings.
 // See https://github.com/jmoiron/sqlx/issues/135
@@ -286,6 +447,84 @@ func mapBytesToString(m map[string]interface{}) {
 // ErrUnknownDriver is returned when an unknown driver is used when attempting to connect.
 var ErrUnknownDriver = errors.New("sqlagent: Unknown driver")
 
+// DriverUnavailableError is returned by Connect when the requested driver
+// is a recognized public name (it's in Drivers), but the internal driver
+// it maps to didn't compile into this binary, typically because it needs
+// cgo and a system client library gated behind a build tag (see
+// MarkDriverUnavailable). Reason is a human-readable remediation hint.
+type DriverUnavailableError struct {
+	Driver string
+	Reason string
+}
+
+func (e *DriverUnavailableError) Error() string {
+	return fmt.Sprintf("sqlagent: driver %q is unavailable: %s", e.Driver, e.Reason)
+}
+
+var (
+	unavailableDrivers      = make(map[string]string) // internal driver name -> reason
+	unavailableDriversMutex sync.RWMutex
+)
+
+// MarkDriverUnavailable records that the internal driver name didn't
+// compile into this binary, along with a reason/remediation hint (e.g.
+// "build with -tags oracle and an installed Oracle Instant Client").
+// cmd/sql-agent's build-tag-gated driver files (oracle.go, odbc.go,
+// informix.go) call this from their "tag not set" complement file, so
+// Connect and GET /drivers can report a clear, actionable error instead of
+// only discovering the gap once a query tries to use the driver and
+// database/sql rejects it with a generic "unknown driver" error.
+func MarkDriverUnavailable(internal, reason string) {
+	unavailableDriversMutex.Lock()
+	defer unavailableDriversMutex.Unlock()
+	unavailableDrivers[internal] = reason
+}
+
+// UnavailableReason returns why the internal driver name is unavailable,
+// and whether it is. It does nothing with public driver names; callers
+// resolve those through Drivers first.
+func UnavailableReason(internal string) (string, bool) {
+	unavailableDriversMutex.RLock()
+	defer unavailableDriversMutex.RUnlock()
+	reason, ok := unavailableDrivers[internal]
+	return reason, ok
+}
+
+// FetchSizeParams maps an internal driver name to the DSN parameter key
+// that controls how many rows its vendored client library fetches per
+// round trip to the server. A driver absent from this map has no such
+// knob in its vendored version, so a fetch_size request option has no
+// effect for it; see ApplyFetchSize.
+var FetchSizeParams = map[string]string{
+	// go-oci8 reads this straight out of the DSN query string (dsn.prefetch_rows
+	// in its vendored oci8.go) and sets OCI_ATTR_PREFETCH_ROWS per statement
+	// from it.
+	"oci8": "prefetch_rows",
+}
+
+// ApplyFetchSize returns a copy of params with the internal driver's
+// fetch-size DSN parameter set to size, and true, if the driver has one
+// registered in FetchSizeParams. Otherwise it returns params unchanged and
+// false, so the caller can surface that fetch_size had no effect instead
+// of silently no-oping: this vendored go-mssqldb has no client-settable
+// packet size parameter, and tuning Postgres's fetch count needs rewriting
+// the query around a DECLARE CURSOR/FETCH loop rather than a DSN option,
+// so neither driver is in FetchSizeParams.
+func ApplyFetchSize(internal string, params map[string]interface{}, size int) (map[string]interface{}, bool) {
+	key, ok := FetchSizeParams[internal]
+	if !ok || size <= 0 {
+		return params, false
+	}
+
+	out := make(map[string]interface{}, len(params)+1)
+	for k, v := range params {
+		out[k] = v
+	}
+	out[key] = size
+
+	return out, true
+}
+
 // Drivers contains a map of public driver names to registered driver names.
 var Drivers = map[string]string{
 	"postgresql": "postgres",
@@ -295,6 +534,28 @@ var Drivers = map[string]string{
 	"sqlite":     "sqlite3",
 	"mssql":      "mssql",
 	"sqlserver":  "mssql",
-	"oracle":     "oci8",
 	"snowflake":  "snowflake",
+
+	// oracle only works when the binary is built with the "oracle" build
+	// tag and an installed Oracle Instant Client; see
+	// cmd/sql-agent/oracle.go.
+	"oracle": "oci8",
+
+	// cockroachdb speaks the Postgres wire protocol, so it reuses the
+	// postgres driver and connector; only its SQL dialect differs (see
+	// DecorateSnapshot's AS OF SYSTEM TIME handling).
+	"cockroachdb": "postgres",
+
+	// odbc only works when the binary is built with the "odbc" build tag
+	// and an installed ODBC driver manager; see cmd/sql-agent/odbc.go.
+	"odbc": "odbc",
+
+	// firebird only works when the binary is built with the "firebird"
+	// build tag; see cmd/sql-agent/firebird.go.
+	"firebird": "firebirdsql",
+
+	// informix only works when the binary is built with the "informix"
+	// build tag and the IBM CSDK client libraries; see
+	// cmd/sql-agent/informix.go.
+	"informix": "go_ibm_db",
 }
@@ -0,0 +1,44 @@
+package sqlagent
+
+import "sync"
+
+// DriverLogLevelObserver, when set, is called every time SetDriverLogLevel
+// changes the level recorded for internal. cmd/sql-agent wires this to
+// whatever knob a given vendored driver actually exposes (e.g. glog's
+// global "-v" flag for gosnowflake) instead of the root package linking
+// against concrete driver or logging packages itself.
+var DriverLogLevelObserver func(internal string, level int)
+
+var (
+	driverLogLevels      = make(map[string]int) // internal driver name -> level
+	driverLogLevelsMutex sync.RWMutex
+)
+
+// SetDriverLogLevel records the verbosity level for the internal driver
+// name, so a specific backend's log noise (e.g. Snowflake request/retry
+// tracing) can be turned up or down at runtime via the admin API, without
+// restarting the process or affecting every other driver sharing the same
+// vendored logging library.
+//
+// The level's meaning is driver-specific; by convention 0 is "off" and
+// higher numbers are progressively more verbose, matching glog's "-v"
+// convention, which is what the one vendored driver that supports this
+// today (gosnowflake, via glog) uses.
+func SetDriverLogLevel(internal string, level int) {
+	driverLogLevelsMutex.Lock()
+	driverLogLevels[internal] = level
+	driverLogLevelsMutex.Unlock()
+
+	if DriverLogLevelObserver != nil {
+		DriverLogLevelObserver(internal, level)
+	}
+}
+
+// DriverLogLevel returns the level most recently set for the internal
+// driver name via SetDriverLogLevel, and whether one has been set at all.
+func DriverLogLevel(internal string) (int, bool) {
+	driverLogLevelsMutex.RLock()
+	defer driverLogLevelsMutex.RUnlock()
+	level, ok := driverLogLevels[internal]
+	return level, ok
+}
@@ -4,12 +4,188 @@ import (
 	"database/sql"
 	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"io"
+	"sync"
 )
 
 // Encoder provides an satisfies the encoder type.
 type Encoder func(io.Writer, *Iterator) error
 
+// RowEncoder is the extension point for output formats: Begin is called
+// once with the query's column names, WriteRow once per result row (in
+// the iterator's FieldOptions-applied shape, same as EncodeJSON), and End
+// once after the last row to close out the format (e.g. a JSON array's
+// closing bracket). Implementations register a factory by MIME type with
+// RegisterEncoder, and EncodeStream drives any registered encoder without
+// needing to know anything about the format it produces.
+type RowEncoder interface {
+	Begin(cols []string) error
+	WriteRow(r Record) error
+	End() error
+}
+
+// EncoderFactory constructs a fresh RowEncoder writing to w. EncodeStream
+// calls it once per call, so a factory may hold per-stream state (e.g. a
+// row counter for delimiter placement) in the RowEncoder it returns.
+type EncoderFactory func(w io.Writer) RowEncoder
+
+var (
+	rowEncoders      = make(map[string]EncoderFactory)
+	rowEncodersMutex sync.RWMutex
+)
+
+// RegisterEncoder registers f as the RowEncoder factory for mimetype,
+// replacing any existing registration (including the built-in
+// "application/json" and "text/csv" encoders EncodeJSON and
+// EncodeStream("text/csv", ...) are implemented on top of). A host binary
+// calls this from an init() to add a proprietary output format, or to
+// change what the built-in MIME types produce, without the HTTP handler
+// needing to know the format exists.
+func RegisterEncoder(mimetype string, f EncoderFactory) {
+	rowEncodersMutex.Lock()
+	defer rowEncodersMutex.Unlock()
+	rowEncoders[mimetype] = f
+}
+
+// EncoderRegistered reports whether mimetype has a RowEncoder registered,
+// so a host binary can decide whether to accept a request for it before
+// calling EncodeStream.
+func EncoderRegistered(mimetype string) bool {
+	rowEncodersMutex.RLock()
+	defer rowEncodersMutex.RUnlock()
+	_, ok := rowEncoders[mimetype]
+	return ok
+}
+
+// EncodeStream streams i through the RowEncoder registered for mimetype,
+// applying the iterator's field options (if set) to every record exactly
+// like EncodeJSON does, flushing w after each row. It returns an error if
+// no encoder is registered for mimetype.
+func EncodeStream(mimetype string, w io.Writer, i *Iterator) error {
+	rowEncodersMutex.RLock()
+	factory, ok := rowEncoders[mimetype]
+	rowEncodersMutex.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("sqlagent: no encoder registered for %q", mimetype)
+	}
+
+	enc := factory(w)
+
+	if err := enc.Begin(i.Cols); err != nil {
+		return err
+	}
+
+	r := make(Record)
+
+	for i.Next() {
+		if err := i.Scan(r); err != nil {
+			return err
+		}
+
+		if err := enc.WriteRow(r); err != nil {
+			return err
+		}
+
+		flush(w)
+	}
+
+	return enc.End()
+}
+
+// jsonRowEncoder is the built-in "application/json" RowEncoder: a JSON
+// array of records, the same wire format EncodeJSON has always produced.
+type jsonRowEncoder struct {
+	enc   *json.Encoder
+	w     io.Writer
+	count int
+}
+
+func (e *jsonRowEncoder) Begin(cols []string) error {
+	_, err := e.w.Write([]byte{'['})
+	return err
+}
+
+func (e *jsonRowEncoder) WriteRow(r Record) error {
+	if e.count > 0 {
+		if _, err := e.w.Write([]byte{',', '\n'}); err != nil {
+			return err
+		}
+	}
+
+	e.count++
+	return e.enc.Encode(r)
+}
+
+func (e *jsonRowEncoder) End() error {
+	_, err := e.w.Write([]byte{']'})
+	return err
+}
+
+// csvRowEncoder is the built-in "text/csv" RowEncoder. It formats each
+// value with fmt.Sprint keyed by column name, the same approach
+// EncodeBufferedCSV already uses for buffered CSV responses; EncodeStream
+// therefore renders live and buffered CSV output identically, where the
+// older ScanRow-based EncodeCSV (kept for backward compatibility) instead
+// gets each value's string form from the driver via sql.NullString.
+type csvRowEncoder struct {
+	w    io.Writer
+	enc  *csv.Writer
+	cols []string
+	row  []string
+}
+
+func (e *csvRowEncoder) Begin(cols []string) error {
+	e.cols = cols
+	e.row = make([]string, len(cols))
+	e.enc = csv.NewWriter(e.w)
+	return e.enc.Write(cols)
+}
+
+func (e *csvRowEncoder) WriteRow(r Record) error {
+	for i, c := range e.cols {
+		if v, ok := r[c]; ok && v != nil {
+			e.row[i] = fmt.Sprint(v)
+		} else {
+			e.row[i] = ""
+		}
+	}
+
+	if err := e.enc.Write(e.row); err != nil {
+		return err
+	}
+
+	e.enc.Flush()
+	return e.enc.Error()
+}
+
+func (e *csvRowEncoder) End() error {
+	return nil
+}
+
+func init() {
+	RegisterEncoder("application/json", func(w io.Writer) RowEncoder {
+		return &jsonRowEncoder{w: w, enc: json.NewEncoder(w)}
+	})
+	RegisterEncoder("text/csv", func(w io.Writer) RowEncoder {
+		return &csvRowEncoder{w: w}
+	})
+}
+
+// flush flushes w if it supports incremental flushing (such as an HTTP
+// response writer), so rows reach the client as they are written instead of
+// sitting in an internal buffer until the whole result set is ready.
+func flush(w io.Writer) {
+	if f, ok := w.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+}
+
+// EncodeCSV encodes the iterator as CSV using database/sql's NULL-aware
+// scanning directly (bypassing FieldOptions, as documented on
+// SetFieldOptions), kept for backward compatibility with existing callers.
+// New format integrations should use RegisterEncoder/EncodeStream instead.
 func EncodeCSV(w io.Writer, i *Iterator) error {
 	r := make([]interface{}, len(i.Cols), len(i.Cols))
 	o := make([]string, len(i.Cols), len(i.Cols))
@@ -42,26 +218,81 @@ func EncodeCSV(w io.Writer, i *Iterator) error {
 		if err := enc.Write(o); err != nil {
 			return err
 		}
+
+		enc.Flush()
+		flush(w)
 	}
 
-	enc.Flush()
 	return enc.Error()
 }
 
-// EncodeJSON encodes the iterator as a JSON array of records.
+// EncodeJSON encodes the iterator as a JSON array of records. It is
+// implemented on top of the "application/json" RowEncoder registered with
+// RegisterEncoder, so replacing that registration also changes what
+// EncodeJSON produces.
 func EncodeJSON(w io.Writer, i *Iterator) error {
+	return EncodeStream("application/json", w, i)
+}
+
+// EncodeLDJSON encodes the iterator as a line delimited stream
+// of records.
+func EncodeLDJSON(w io.Writer, i *Iterator) error {
 	r := make(Record)
 
-	// Open paren.
-	if _, err := w.Write([]byte{'['}); err != nil {
-		return err
+	enc := json.NewEncoder(w)
+
+	for i.Next() {
+		if err := i.Scan(r); err != nil {
+			return err
+		}
+
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+
+		flush(w)
 	}
 
-	var c int
+	return nil
+}
+
+// EnvelopeMeta carries arbitrary metadata into a v2 response envelope's
+// "meta" field, alongside "columns", "rows", and "error".
+type EnvelopeMeta map[string]interface{}
+
+// EncodeJSONEnvelope writes the iterator as a versioned response envelope
+// ({"meta": ..., "columns": [...], "rows": [...], "error": null}) instead
+// of the legacy bare array EncodeJSON produces, so richer metadata can ship
+// without breaking v1 clients. A query error encountered mid-stream still
+// truncates the body, the same limitation EncodeJSON has.
+func EncodeJSONEnvelope(w io.Writer, i *Iterator, meta EnvelopeMeta) error {
 	enc := json.NewEncoder(w)
 
+	if _, err := w.Write([]byte(`{"meta":`)); err != nil {
+		return err
+	}
+
+	if err := enc.Encode(meta); err != nil {
+		return err
+	}
+
+	if _, err := w.Write([]byte(`,"columns":`)); err != nil {
+		return err
+	}
+
+	if err := enc.Encode(i.Cols); err != nil {
+		return err
+	}
+
+	if _, err := w.Write([]byte(`,"rows":[`)); err != nil {
+		return err
+	}
+
+	r := make(Record)
 	delim := []byte{',', '\n'}
 
+	var c int
+
 	for i.Next() {
 		if c > 0 {
 			if _, err := w.Write(delim); err != nil {
@@ -78,32 +309,129 @@ func EncodeJSON(w io.Writer, i *Iterator) error {
 		if err := enc.Encode(r); err != nil {
 			return err
 		}
+
+		flush(w)
 	}
 
-	// Close paren.
-	if _, err := w.Write([]byte{']'}); err != nil {
+	_, err := w.Write([]byte(`],"error":null}`))
+	return err
+}
+
+// EncodeBufferedJSONEnvelope writes a fully materialized RowBuffer as a
+// versioned response envelope, the same wire format as EncodeJSONEnvelope.
+func EncodeBufferedJSONEnvelope(w io.Writer, cols []string, b *RowBuffer, meta EnvelopeMeta) error {
+	enc := json.NewEncoder(w)
+
+	if _, err := w.Write([]byte(`{"meta":`)); err != nil {
 		return err
 	}
 
-	return nil
+	if err := enc.Encode(meta); err != nil {
+		return err
+	}
+
+	if _, err := w.Write([]byte(`,"columns":`)); err != nil {
+		return err
+	}
+
+	if err := enc.Encode(cols); err != nil {
+		return err
+	}
+
+	if _, err := w.Write([]byte(`,"rows":[`)); err != nil {
+		return err
+	}
+
+	delim := []byte{',', '\n'}
+	var c int
+
+	err := b.Each(func(r Record) error {
+		if c > 0 {
+			if _, err := w.Write(delim); err != nil {
+				return err
+			}
+		}
+
+		c++
+		return enc.Encode(r)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write([]byte(`],"error":null}`))
+	return err
 }
 
-// EncodeLDJSON encodes the iterator as a line delimited stream
-// of records.
-func EncodeLDJSON(w io.Writer, i *Iterator) error {
-	r := make(Record)
+// EncodeBufferedCSV writes a fully materialized RowBuffer as CSV, the same
+// wire format as EncodeCSV, using cols to order each record's fields.
+func EncodeBufferedCSV(w io.Writer, cols []string, b *RowBuffer) error {
+	enc := csv.NewWriter(w)
 
-	enc := json.NewEncoder(w)
+	if err := enc.Write(cols); err != nil {
+		return err
+	}
 
-	for i.Next() {
-		if err := i.Scan(r); err != nil {
-			return err
+	row := make([]string, len(cols))
+
+	err := b.Each(func(r Record) error {
+		for i, c := range cols {
+			if v, ok := r[c]; ok && v != nil {
+				row[i] = fmt.Sprint(v)
+			} else {
+				row[i] = ""
+			}
 		}
 
-		if err := enc.Encode(r); err != nil {
-			return err
+		return enc.Write(row)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	enc.Flush()
+	return enc.Error()
+}
+
+// EncodeBufferedJSON writes a fully materialized RowBuffer as a JSON array,
+// the same wire format as EncodeJSON.
+func EncodeBufferedJSON(w io.Writer, b *RowBuffer) error {
+	if _, err := w.Write([]byte{'['}); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	delim := []byte{',', '\n'}
+
+	var c int
+
+	err := b.Each(func(r Record) error {
+		if c > 0 {
+			if _, err := w.Write(delim); err != nil {
+				return err
+			}
 		}
+
+		c++
+		return enc.Encode(r)
+	})
+
+	if err != nil {
+		return err
 	}
 
-	return nil
+	_, err = w.Write([]byte{']'})
+	return err
+}
+
+// EncodeBufferedLDJSON writes a fully materialized RowBuffer as a line
+// delimited stream of records, the same wire format as EncodeLDJSON.
+func EncodeBufferedLDJSON(w io.Writer, b *RowBuffer) error {
+	enc := json.NewEncoder(w)
+
+	return b.Each(func(r Record) error {
+		return enc.Encode(r)
+	})
 }
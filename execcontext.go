@@ -0,0 +1,65 @@
+package sqlagent
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// namedQueryContext is NamedQuery with ctx forwarded to the driver via the
+// embedded *sql.DB's QueryContext. The vendored sqlx predates sqlx's own
+// NamedQueryContext, so named-parameter binding is done by hand with
+// BindNamed first.
+func namedQueryContext(ctx context.Context, db *sqlx.DB, query string, arg interface{}) (*sqlx.Rows, error) {
+	q, args, err := db.BindNamed(query, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlx.Rows{Rows: rows, Mapper: db.Mapper}, nil
+}
+
+// queryxContext is Queryx with ctx forwarded to the driver via the embedded
+// *sql.DB's QueryContext.
+func queryxContext(ctx context.Context, db *sqlx.DB, query string) (*sqlx.Rows, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlx.Rows{Rows: rows, Mapper: db.Mapper}, nil
+}
+
+// namedQueryConnContext is namedQueryContext/queryxContext run on a
+// specific reserved conn rather than borrowed from db's pool, so a caller
+// that needs session affinity across statements (e.g. Snowflake's
+// LAST_QUERY_ID(), see Execute) can be sure a follow-up statement lands on
+// the same connection. params may be nil or empty.
+func namedQueryConnContext(ctx context.Context, db *sqlx.DB, conn *sql.Conn, query string, params map[string]interface{}) (*sqlx.Rows, error) {
+	if params == nil || len(params) == 0 {
+		rows, err := conn.QueryContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+
+		return &sqlx.Rows{Rows: rows, Mapper: db.Mapper}, nil
+	}
+
+	q, args, err := db.BindNamed(query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlx.Rows{Rows: rows, Mapper: db.Mapper}, nil
+}
@@ -0,0 +1,136 @@
+package sqlagent
+
+import "strings"
+
+// FieldOptions controls how a Record's columns are projected, renamed,
+// flattened, and cased before encoding. It only applies to Record-based
+// output (EncodeJSON, EncodeLDJSON, and their buffered equivalents); CSV
+// output stays tied to the query's own column order, since renaming or
+// flattening there is already idiomatically done with `AS` aliases in SQL.
+type FieldOptions struct {
+	// Select lists the output columns to keep. Empty means keep all
+	// columns. Applied before Rename, so names here refer to the
+	// original (or, if Flatten is set, the flattened) column names.
+	Select []string
+
+	// Rename maps an original column name to its output name. Columns not
+	// listed keep their existing name.
+	Rename map[string]string
+
+	// Flatten expands nested object values (e.g. a Postgres JSONB or
+	// decoded Snowflake VARIANT column) into dotted keys, e.g.
+	// "address.city", instead of leaving them as a nested value.
+	Flatten bool
+
+	// Case rewrites every output column name: "lower" or "camel". Empty
+	// leaves names as the driver returned them.
+	Case string
+}
+
+// Apply projects, renames, flattens, and case-converts r, returning a new
+// Record; r itself is left untouched.
+func (o FieldOptions) Apply(r Record) Record {
+	out := Record(r)
+
+	if o.Flatten {
+		out = flattenRecord(out)
+	}
+
+	if len(o.Select) > 0 {
+		selected := make(Record, len(o.Select))
+
+		for _, k := range o.Select {
+			if v, ok := out[k]; ok {
+				selected[k] = v
+			}
+		}
+
+		out = selected
+	}
+
+	if len(o.Rename) > 0 {
+		renamed := make(Record, len(out))
+
+		for k, v := range out {
+			if nk, ok := o.Rename[k]; ok {
+				renamed[nk] = v
+			} else {
+				renamed[k] = v
+			}
+		}
+
+		out = renamed
+	}
+
+	switch o.Case {
+	case "lower":
+		out = mapRecordKeys(out, strings.ToLower)
+	case "camel":
+		out = mapRecordKeys(out, toCamelCase)
+	}
+
+	return out
+}
+
+// flattenRecord expands nested map values in r into dotted keys.
+func flattenRecord(r Record) Record {
+	out := make(Record, len(r))
+
+	for k, v := range r {
+		flattenInto(out, k, v)
+	}
+
+	return out
+}
+
+func flattenInto(out Record, prefix string, v interface{}) {
+	switch x := v.(type) {
+	case Record:
+		for k, vv := range x {
+			flattenInto(out, prefix+"."+k, vv)
+		}
+	case map[string]interface{}:
+		for k, vv := range x {
+			flattenInto(out, prefix+"."+k, vv)
+		}
+	default:
+		out[prefix] = v
+	}
+}
+
+func mapRecordKeys(r Record, f func(string) string) Record {
+	out := make(Record, len(r))
+
+	for k, v := range r {
+		out[f(k)] = v
+	}
+
+	return out
+}
+
+// toCamelCase converts a snake_case, kebab-case, or space separated column
+// name (e.g. "first_name") into lowerCamelCase ("firstName").
+func toCamelCase(s string) string {
+	parts := strings.FieldsFunc(s, func(r rune) bool {
+		return r == '_' || r == '-' || r == ' '
+	})
+
+	if len(parts) == 0 {
+		return s
+	}
+
+	var b strings.Builder
+
+	b.WriteString(strings.ToLower(parts[0]))
+
+	for _, p := range parts[1:] {
+		if p == "" {
+			continue
+		}
+
+		b.WriteString(strings.ToUpper(p[:1]))
+		b.WriteString(strings.ToLower(p[1:]))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,59 @@
+package sqlagent
+
+import "regexp"
+
+// LintWarning is one anti-pattern flagged by Lint.
+type LintWarning struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+var (
+	lintSelectStar      = regexp.MustCompile(`(?i)^\s*select\s+\*`)
+	lintDelete          = regexp.MustCompile(`(?i)^\s*delete\s+from\s+\S+`)
+	lintUpdate          = regexp.MustCompile(`(?i)^\s*update\s+\S+\s+set\b`)
+	lintWhere           = regexp.MustCompile(`(?i)\bwhere\b`)
+	lintWrappedColumn   = regexp.MustCompile(`(?i)\bwhere\b[\s\S]*\b(?:upper|lower|trim|cast|convert)\s*\(`)
+	lintLeadingWildcard = regexp.MustCompile(`(?i)\blike\s+'%`)
+	lintCrossJoin       = regexp.MustCompile(`(?i)\bcross\s+join\b`)
+	lintCommaJoin       = regexp.MustCompile(`(?i)\bfrom\s+\S+\s*,\s*\S+`)
+)
+
+// Lint runs a lightweight, heuristic pass over sql looking for common
+// anti-patterns: SELECT *, a DELETE/UPDATE with no WHERE clause, predicates
+// that defeat index usage, and cartesian-product joins. It does not parse
+// SQL, so it can both miss real issues and flag false positives; it is
+// meant as an advisory nudge, not a guarantee, and callers decide via
+// Profile.EffectiveLintMode whether a warning merely gets reported or
+// blocks execution.
+func Lint(sql string) []LintWarning {
+	var warnings []LintWarning
+
+	if lintSelectStar.MatchString(sql) {
+		warnings = append(warnings, LintWarning{"select-star", "SELECT * transfers every column and breaks silently on schema changes; name the columns you need"})
+	}
+
+	hasWhere := lintWhere.MatchString(sql)
+
+	if lintDelete.MatchString(sql) && !hasWhere {
+		warnings = append(warnings, LintWarning{"unbounded-delete", "DELETE without a WHERE clause removes every row in the table"})
+	}
+
+	if lintUpdate.MatchString(sql) && !hasWhere {
+		warnings = append(warnings, LintWarning{"unbounded-update", "UPDATE without a WHERE clause modifies every row in the table"})
+	}
+
+	if lintWrappedColumn.MatchString(sql) {
+		warnings = append(warnings, LintWarning{"non-sargable-predicate", "a function wrapped around a column in WHERE prevents the database from using an index on it"})
+	}
+
+	if lintLeadingWildcard.MatchString(sql) {
+		warnings = append(warnings, LintWarning{"non-sargable-predicate", "a LIKE pattern with a leading % cannot use a standard index"})
+	}
+
+	if lintCrossJoin.MatchString(sql) || (lintCommaJoin.MatchString(sql) && !hasWhere) {
+		warnings = append(warnings, LintWarning{"cartesian-join", "joining tables without a condition produces a cartesian product"})
+	}
+
+	return warnings
+}
@@ -0,0 +1,249 @@
+package sqlagent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ColumnType is a backend-independent column type inferred from sample
+// values, mapped to each driver's concrete DDL type by columnTypeNames.
+type ColumnType int
+
+const (
+	ColumnText ColumnType = iota
+	ColumnInteger
+	ColumnFloat
+	ColumnBoolean
+	ColumnTimestamp
+)
+
+// ColumnSchema describes one inferred column of a table to be created by
+// LoadRecords.
+type ColumnSchema struct {
+	Name     string
+	Type     ColumnType
+	Nullable bool
+}
+
+// columnTypeNames maps each internal driver name to the DDL type name used
+// for each ColumnType, mirroring Dialects' per-driver lookup convention.
+var columnTypeNames = map[string]map[ColumnType]string{
+	"postgres":  {ColumnText: "text", ColumnInteger: "bigint", ColumnFloat: "double precision", ColumnBoolean: "boolean", ColumnTimestamp: "timestamp"},
+	"mysql":     {ColumnText: "text", ColumnInteger: "bigint", ColumnFloat: "double", ColumnBoolean: "boolean", ColumnTimestamp: "datetime"},
+	"sqlite3":   {ColumnText: "TEXT", ColumnInteger: "INTEGER", ColumnFloat: "REAL", ColumnBoolean: "INTEGER", ColumnTimestamp: "TEXT"},
+	"mssql":     {ColumnText: "nvarchar(max)", ColumnInteger: "bigint", ColumnFloat: "float", ColumnBoolean: "bit", ColumnTimestamp: "datetime2"},
+	"snowflake": {ColumnText: "string", ColumnInteger: "number", ColumnFloat: "float", ColumnBoolean: "boolean", ColumnTimestamp: "timestamp_ntz"},
+}
+
+// InferSchema derives a column schema from a sample of records, widening
+// each column's type to accommodate every value seen and marking it
+// nullable if any sampled record omitted it or set it to nil. Column order
+// follows the first record that defines each key.
+func InferSchema(sample []Record) []ColumnSchema {
+	var order []string
+
+	seen := map[string]bool{}
+	types := map[string]ColumnType{}
+	nullable := map[string]bool{}
+
+	for _, r := range sample {
+		for _, name := range order {
+			if _, ok := r[name]; !ok {
+				nullable[name] = true
+			}
+		}
+
+		for k, v := range r {
+			t := columnTypeFor(v)
+
+			if !seen[k] {
+				seen[k] = true
+				order = append(order, k)
+				types[k] = t
+			} else {
+				types[k] = widenColumnType(types[k], t)
+			}
+
+			if v == nil {
+				nullable[k] = true
+			}
+		}
+	}
+
+	cols := make([]ColumnSchema, len(order))
+	for i, name := range order {
+		cols[i] = ColumnSchema{Name: name, Type: types[name], Nullable: nullable[name]}
+	}
+
+	return cols
+}
+
+// columnTypeFor classifies a single decoded value. json.Number values
+// without a fractional or exponent part are treated as integers, so a
+// json.Decoder using UseNumber can feed this without losing that
+// distinction to float64.
+func columnTypeFor(v interface{}) ColumnType {
+	switch x := v.(type) {
+	case nil:
+		return ColumnText
+	case bool:
+		return ColumnBoolean
+	case time.Time:
+		return ColumnTimestamp
+	case json.Number:
+		if strings.ContainsAny(string(x), ".eE") {
+			return ColumnFloat
+		}
+		return ColumnInteger
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return ColumnInteger
+	case float32, float64:
+		return ColumnFloat
+	default:
+		return ColumnText
+	}
+}
+
+// widenColumnType picks the narrowest type that can represent values of
+// both a and b, falling back to text when they're otherwise incompatible.
+func widenColumnType(a, b ColumnType) ColumnType {
+	if a == b {
+		return a
+	}
+
+	if (a == ColumnInteger && b == ColumnFloat) || (a == ColumnFloat && b == ColumnInteger) {
+		return ColumnFloat
+	}
+
+	return ColumnText
+}
+
+// CreateTableStatement builds a CREATE TABLE statement for driver from an
+// inferred schema, quoting identifiers per its dialect.
+func CreateTableStatement(driver, table string, cols []ColumnSchema) (string, error) {
+	names, ok := columnTypeNames[driver]
+	if !ok {
+		return "", ErrUnknownDialect
+	}
+
+	qTable, err := QuoteIdentifier(driver, table)
+	if err != nil {
+		return "", err
+	}
+
+	defs := make([]string, len(cols))
+
+	for i, c := range cols {
+		qCol, err := QuoteIdentifier(driver, c.Name)
+		if err != nil {
+			return "", err
+		}
+
+		def := qCol + " " + names[c.Type]
+		if !c.Nullable {
+			def += " NOT NULL"
+		}
+
+		defs[i] = def
+	}
+
+	return fmt.Sprintf("CREATE TABLE %s (%s)", qTable, strings.Join(defs, ", ")), nil
+}
+
+// LoadRecords inserts records into table, creating it first from an
+// inferred schema when createTable is true. All inserts run in a single
+// transaction, so a failure partway through leaves no rows behind. ctx
+// bounds the whole load, the same deadline-propagation-into-the-driver
+// approach ExecBatch uses. It returns the number of rows inserted.
+func LoadRecords(ctx context.Context, db *sqlx.DB, driver, table string, records []Record, createTable bool) (int64, error) {
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	// The vendored sqlx predates sqlx.Tx's own context-aware methods, so
+	// the transaction is begun via the embedded *sql.DB's BeginTx (same
+	// reasoning as ExecBatch) and each statement is run through the plain
+	// *sql.Tx, binding named params by hand with db.BindNamed.
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if createTable {
+		stmt, err := CreateTableStatement(driver, table, InferSchema(records))
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	qTable, err := QuoteIdentifier(driver, table)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	var n int64
+
+	for _, r := range records {
+		cols := make([]string, 0, len(r))
+		for k := range r {
+			cols = append(cols, k)
+		}
+
+		qCols := make([]string, len(cols))
+		placeholders := make([]string, len(cols))
+
+		for i, c := range cols {
+			qc, err := QuoteIdentifier(driver, c)
+			if err != nil {
+				tx.Rollback()
+				return 0, err
+			}
+
+			qCols[i] = qc
+			placeholders[i] = ":" + c
+		}
+
+		stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", qTable, strings.Join(qCols, ", "), strings.Join(placeholders, ", "))
+
+		q, args, err := db.BindNamed(stmt, map[string]interface{}(r))
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		var result sql.Result
+
+		result, err = tx.ExecContext(ctx, q, args...)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		n += affected
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
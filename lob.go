@@ -0,0 +1,66 @@
+package sqlagent
+
+// LOBThreshold is the byte length at or above which a column value
+// ([]byte or string) is diverted out of the response via LOBSink instead
+// of being inlined, for CLOB/BLOB/large-object columns large enough to
+// blow memory on both ends if returned inline. Zero, the default,
+// disables LOB extraction entirely, inlining every value as before.
+//
+// database/sql (and therefore every vendored driver here, including
+// go-oci8's Oracle CLOB/BLOB support and lib/pq's Postgres bytea support)
+// surfaces a large object column as an ordinary []byte or string value,
+// not a separate streaming locator type, so a byte-length threshold
+// applied uniformly to every column is how this agent can offer the same
+// GET /lob/{token} treatment to both backends without driver-specific
+// code.
+var LOBThreshold int
+
+// LOBSink, when set, is handed the raw bytes of any column value at or
+// above LOBThreshold so a host binary can spool it somewhere (e.g. a
+// temporary file served from GET /lob/{token}, as cmd/sql-agent does)
+// and return a token identifying it. The root package has no
+// HTTP/storage dependency of its own, mirroring the CredentialResolver
+// and ShadowObserver hook pattern.
+var LOBSink func(data []byte) (token string, err error)
+
+// LOBRef replaces a large column value in a Record once it's been
+// diverted to LOBSink, so a client fetches the real bytes from GET
+// /lob/{token} instead of receiving them inline.
+type LOBRef struct {
+	LOBToken string `json:"lob_token"`
+	Bytes    int    `json:"bytes"`
+}
+
+// extractLOBs replaces any string or []byte value in r at or above
+// LOBThreshold with a LOBRef, via LOBSink. A sink error leaves that
+// value inlined rather than failing the whole row: a value too large to
+// spool is still better delivered than lost.
+func extractLOBs(r Record) {
+	if LOBSink == nil || LOBThreshold <= 0 {
+		return
+	}
+
+	for k, v := range r {
+		var data []byte
+
+		switch x := v.(type) {
+		case []byte:
+			data = x
+		case string:
+			data = []byte(x)
+		default:
+			continue
+		}
+
+		if len(data) < LOBThreshold {
+			continue
+		}
+
+		token, err := LOBSink(data)
+		if err != nil {
+			continue
+		}
+
+		r[k] = LOBRef{LOBToken: token, Bytes: len(data)}
+	}
+}
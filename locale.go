@@ -0,0 +1,106 @@
+package sqlagent
+
+import (
+	"fmt"
+	"os"
+)
+
+// localeOptionValidators declares, per internal driver, the locale and
+// character-set options this agent understands well enough to validate.
+// Every connection parameter is always passed through to the driver
+// regardless of whether it appears here; this only catches an obviously
+// wrong type or value (e.g. parseTime: "yes") before it reaches the driver
+// as a malformed or silently-ignored DSN parameter, since by the time a
+// query returns mangled non-ASCII data the cause is hard to trace back to
+// the connection map.
+var localeOptionValidators = map[string]map[string]func(interface{}) error{
+	// See https://github.com/go-sql-driver/mysql/#dsn-data-source-name
+	"mysql": {
+		"charset":   validateNonEmptyString,
+		"collation": validateNonEmptyString,
+		"parseTime": validateBoolLike,
+	},
+
+	// See http://godoc.org/github.com/lib/pq#hdr-Connection_String_Parameters
+	"postgres": {
+		"client_encoding": validateNonEmptyString,
+	},
+
+	// go-mssqldb has no dedicated collation parameter; "collation" is
+	// passed through as a connection string attribute, which SQL Server
+	// accepts as a login-time collation hint.
+	// See https://github.com/denisenkom/go-mssqldb#connection-parameters-and-dsn
+	"mssql": {
+		"collation": validateNonEmptyString,
+	},
+
+	// Oracle's NLS_LANG governs both the client character set and
+	// territory/language-dependent formatting, but go-oci8 reads it from
+	// the process environment rather than a DSN parameter; see
+	// applyLocaleOptions.
+	"oci8": {
+		"nls_lang": validateNonEmptyString,
+	},
+}
+
+func validateNonEmptyString(v interface{}) error {
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return fmt.Errorf("must be a non-empty string, got %#v", v)
+	}
+
+	return nil
+}
+
+func validateBoolLike(v interface{}) error {
+	switch x := v.(type) {
+	case bool:
+		return nil
+	case string:
+		if x == "true" || x == "false" {
+			return nil
+		}
+	}
+
+	return fmt.Errorf(`must be true, false, "true", or "false", got %#v`, v)
+}
+
+// applyLocaleOptions validates the locale/charset options recognized for
+// driver (see localeOptionValidators) and, for Oracle, sets NLS_LANG from
+// the "nls_lang" parameter, removing it from params, since go-oci8 reads it
+// from the process environment instead of the DSN.
+func applyLocaleOptions(driver string, params map[string]interface{}) (map[string]interface{}, error) {
+	validators, ok := localeOptionValidators[driver]
+	if !ok {
+		return params, nil
+	}
+
+	for name, validate := range validators {
+		v, present := params[name]
+		if !present {
+			continue
+		}
+
+		if err := validate(v); err != nil {
+			return nil, fmt.Errorf("sqlagent: invalid %q option for driver %q: %s", name, driver, err)
+		}
+	}
+
+	if driver == "oci8" {
+		if v, ok := params["nls_lang"]; ok {
+			cloned := make(map[string]interface{}, len(params))
+
+			for k, val := range params {
+				if k != "nls_lang" {
+					cloned[k] = val
+				}
+			}
+
+			os.Setenv("NLS_LANG", fmt.Sprint(v))
+
+			return cloned, nil
+		}
+	}
+
+	return params, nil
+}
@@ -0,0 +1,73 @@
+package sqlagent
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// MaintenanceWindow declares a span of time during which a profile rejects
+// queries, for planned primary failovers and schema migrations. ReadOnly
+// narrows that to writes only, so read traffic can keep flowing while a
+// migration runs.
+type MaintenanceWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// ReadOnly, when true, only rejects write statements (INSERT, UPDATE,
+	// DELETE, and DDL) during the window; reads are still served. When
+	// false, the window rejects every query.
+	ReadOnly bool `json:"read_only"`
+
+	// Reason is included in the error surfaced to callers, e.g. "primary
+	// failover in progress".
+	Reason string `json:"reason"`
+}
+
+// MaintenanceError is returned by Profile.CheckMaintenance when a query is
+// rejected because its profile is within a maintenance window.
+type MaintenanceError struct {
+	Profile string
+	Reason  string
+}
+
+func (e *MaintenanceError) Error() string {
+	return fmt.Sprintf("sqlagent: profile %q is in maintenance: %s", e.Profile, e.Reason)
+}
+
+var maintenanceWriteStatement = regexp.MustCompile(`(?i)^\s*(insert|update|delete|merge|replace|truncate|alter|drop|create)\b`)
+
+// isWriteStatement reports whether sql looks like a write or DDL statement,
+// using the same best-effort, unparsed, leading-keyword heuristic as Lint
+// and Analyze rather than a real SQL parser.
+func isWriteStatement(sql string) bool {
+	return maintenanceWriteStatement.MatchString(sql)
+}
+
+// CheckMaintenance returns a *MaintenanceError if now falls within one of
+// the profile's maintenance windows that forbids sql, and nil otherwise. A
+// nil profile is never in maintenance.
+func (p *Profile) CheckMaintenance(sql string, now time.Time) error {
+	if p == nil {
+		return nil
+	}
+
+	for _, w := range p.MaintenanceWindows {
+		if now.Before(w.Start) || now.After(w.End) {
+			continue
+		}
+
+		if w.ReadOnly && !isWriteStatement(sql) {
+			continue
+		}
+
+		reason := w.Reason
+		if reason == "" {
+			reason = "scheduled maintenance"
+		}
+
+		return &MaintenanceError{Profile: p.Name, Reason: reason}
+	}
+
+	return nil
+}
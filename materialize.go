@@ -0,0 +1,54 @@
+package sqlagent
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Materialize executes sql against db and writes its result set into a new
+// table named table on the same backend, instead of returning the row data.
+// This lets multi-step agent workflows build on intermediate results
+// without round-tripping them through the client. It returns the number of
+// rows written.
+func Materialize(db *sqlx.DB, driver, table, sql string, params map[string]interface{}) (int64, error) {
+	stmt, err := materializeStatement(driver, table, sql)
+	if err != nil {
+		return 0, err
+	}
+
+	var result interface {
+		RowsAffected() (int64, error)
+	}
+
+	if params != nil && len(params) > 0 {
+		result, err = db.NamedExec(stmt, params)
+	} else {
+		result, err = db.Exec(stmt)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// materializeStatement builds the driver-appropriate statement for writing
+// a SELECT's results into a new table, quoting table per driver's dialect
+// the same way load.go and pagination.go do.
+func materializeStatement(driver, table, sql string) (string, error) {
+	qTable, err := QuoteIdentifier(driver, table)
+	if err != nil {
+		return "", err
+	}
+
+	switch driver {
+	// MSSQL does not support CREATE TABLE ... AS; SELECT ... INTO is the
+	// idiomatic equivalent.
+	case "mssql":
+		return fmt.Sprintf("SELECT * INTO %s FROM (%s) AS materialized_subquery", qTable, sql), nil
+	default:
+		return fmt.Sprintf("CREATE TABLE %s AS %s", qTable, sql), nil
+	}
+}
@@ -0,0 +1,107 @@
+package sqlagent
+
+import (
+	"regexp"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// stmtReturnsRows heuristically identifies a statement that produces a
+// result set, the same kind of non-parsing sniff lint.go and splitter.go
+// already use elsewhere in this package.
+var stmtReturnsRows = regexp.MustCompile(`(?i)^\s*(select|with|show|describe|desc|explain)\b`)
+
+// MultiStatementResult is one statement's outcome within an
+// ExecuteMultiStatement block.
+type MultiStatementResult struct {
+	SQL          string   `json:"sql"`
+	Columns      []string `json:"columns,omitempty"`
+	Rows         []Record `json:"rows,omitempty"`
+	RowsAffected int64    `json:"rows_affected,omitempty"`
+}
+
+// ExecuteMultiStatement runs every statement in sql (split with
+// SplitStatements) in order against a single held connection, via a
+// transaction, so a session-state statement like USE WAREHOUSE or USE
+// SCHEMA takes effect for the statements that follow it in the same block
+// — something a pooled connection can't otherwise guarantee between
+// requests.
+//
+// This does not use gosnowflake's native MULTI_STATEMENT_COUNT wire
+// protocol support; the vendored gosnowflake client predates it. Pinning
+// one connection for the block's duration via a transaction gets the same
+// practical result for session continuity, at the cost of the whole block
+// sharing one commit/rollback instead of Snowflake's own per-statement
+// semantics within a native multi-statement request: the first statement
+// to fail rolls back every statement in the block, including ones that
+// already succeeded.
+func ExecuteMultiStatement(db *sqlx.DB, driver, sql string, params map[string]interface{}) ([]MultiStatementResult, error) {
+	stmts := SplitStatements(driver, sql)
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]MultiStatementResult, 0, len(stmts))
+
+	for _, stmt := range stmts {
+		result := MultiStatementResult{SQL: stmt}
+
+		if stmtReturnsRows.MatchString(stmt) {
+			rows, err := tx.NamedQuery(stmt, params)
+			if err != nil {
+				tx.Rollback()
+				return results, err
+			}
+
+			cols, err := rows.Columns()
+			if err != nil {
+				rows.Close()
+				tx.Rollback()
+				return results, err
+			}
+
+			result.Columns = cols
+
+			for rows.Next() {
+				r := make(Record)
+
+				if err := rows.MapScan(r); err != nil {
+					rows.Close()
+					tx.Rollback()
+					return results, err
+				}
+
+				mapBytesToString(r)
+				result.Rows = append(result.Rows, r)
+			}
+
+			err = rows.Err()
+			rows.Close()
+
+			if err != nil {
+				tx.Rollback()
+				return results, err
+			}
+
+			results = append(results, result)
+			continue
+		}
+
+		res, err := tx.NamedExec(stmt, params)
+		if err != nil {
+			tx.Rollback()
+			return results, err
+		}
+
+		result.RowsAffected, _ = res.RowsAffected()
+		results = append(results, result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return results, err
+	}
+
+	return results, nil
+}
@@ -0,0 +1,117 @@
+package sqlagent
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PageRequest describes how a client wants a query's results paginated, so
+// Paginate can rewrite the query with dialect-appropriate syntax instead of
+// requiring callers to hand-write LIMIT/OFFSET or keyset SQL for every
+// backend.
+type PageRequest struct {
+	// Limit is the maximum number of rows to return. It is required.
+	Limit int
+
+	// Offset skips this many rows before Limit takes effect. Ignored when
+	// After is set, in favor of keyset pagination.
+	Offset int
+
+	// SortKey is the column results are ordered by. It is required for
+	// keyset pagination and for MSSQL/Oracle offset pagination, both of
+	// which need a deterministic ORDER BY to page against.
+	SortKey string
+
+	// After, when non-nil, requests keyset pagination: only rows whose
+	// SortKey value is greater than After are returned. This avoids the
+	// performance cliff a large OFFSET causes on backends without server
+	// cursors. SortKey must also be set.
+	After interface{}
+}
+
+// ErrPaginationRequiresSortKey is returned by Paginate when keyset
+// pagination, or offset pagination on a driver whose syntax requires a
+// deterministic ORDER BY, is requested without PageRequest.SortKey set.
+var ErrPaginationRequiresSortKey = fmt.Errorf("sqlagent: pagination requires a sort key for this driver or mode")
+
+// Paginate rewrites sql to return one page of results per p, using
+// driver's dialect: a keyset predicate when p.After is set, otherwise
+// LIMIT/OFFSET for Postgres, MySQL, SQLite, and Snowflake, OFFSET ...
+// FETCH NEXT for MSSQL, and a ROWNUM wrapper for Oracle (oci8), since
+// neither of the latter two supports the ANSI LIMIT clause.
+func Paginate(driver, sql string, p PageRequest) (string, error) {
+	trimmed := strings.TrimRight(strings.TrimSpace(sql), ";")
+
+	if p.After != nil {
+		if p.SortKey == "" {
+			return "", ErrPaginationRequiresSortKey
+		}
+
+		return paginateKeyset(driver, trimmed, p)
+	}
+
+	switch driver {
+	case "mssql":
+		// OFFSET ... FETCH NEXT requires an ORDER BY in the same query.
+		if p.SortKey == "" {
+			return "", ErrPaginationRequiresSortKey
+		}
+
+		col, err := QuoteIdentifier(driver, p.SortKey)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%s ORDER BY %s OFFSET %d ROWS FETCH NEXT %d ROWS ONLY", trimmed, col, p.Offset, p.Limit), nil
+
+	case "oci8":
+		// Oracle has no LIMIT clause, so pagination instead wraps the
+		// query and filters on the pseudo-column ROWNUM, the classic
+		// two-level wrapper that also works on pre-12c databases that
+		// lack FETCH FIRST.
+		order := ""
+
+		if p.SortKey != "" {
+			col, err := QuoteIdentifier(driver, p.SortKey)
+			if err != nil {
+				return "", err
+			}
+
+			order = " ORDER BY " + col
+		}
+
+		return fmt.Sprintf(
+			"SELECT * FROM (SELECT sqlagent_page.*, ROWNUM sqlagent_rnum FROM (%s%s) sqlagent_page WHERE ROWNUM <= %d) WHERE sqlagent_rnum > %d",
+			trimmed, order, p.Offset+p.Limit, p.Offset,
+		), nil
+
+	default:
+		return fmt.Sprintf("%s LIMIT %d OFFSET %d", trimmed, p.Limit, p.Offset), nil
+	}
+}
+
+// paginateKeyset wraps sql as a derived table and appends a predicate on
+// the last seen SortKey value instead of an OFFSET, so paging deep into a
+// large result set costs the same as paging near the start.
+func paginateKeyset(driver, sql string, p PageRequest) (string, error) {
+	col, err := QuoteIdentifier(driver, p.SortKey)
+	if err != nil {
+		return "", err
+	}
+
+	literal, err := QuoteLiteral(driver, p.After)
+	if err != nil {
+		return "", err
+	}
+
+	wrapped := fmt.Sprintf("SELECT * FROM (%s) sqlagent_keyset WHERE %s > %s ORDER BY %s", sql, col, literal, col)
+
+	switch driver {
+	case "mssql":
+		return fmt.Sprintf("%s OFFSET 0 ROWS FETCH NEXT %d ROWS ONLY", wrapped, p.Limit), nil
+	case "oci8":
+		return fmt.Sprintf("SELECT * FROM (%s) WHERE ROWNUM <= %d", wrapped, p.Limit), nil
+	default:
+		return fmt.Sprintf("%s LIMIT %d", wrapped, p.Limit), nil
+	}
+}
@@ -0,0 +1,70 @@
+package sqlagent
+
+import "time"
+
+// probeQueries maps each internal driver name to a trivial query used to
+// verify connectivity without touching any real data.
+var probeQueries = map[string]string{
+	"postgres":  "SELECT 1",
+	"mysql":     "SELECT 1",
+	"sqlite3":   "SELECT 1",
+	"mssql":     "SELECT 1",
+	"oci8":      "SELECT 1 FROM DUAL",
+	"snowflake": "SELECT 1",
+}
+
+// versionQueries maps each internal driver name to a query returning the
+// server's version string.
+var versionQueries = map[string]string{
+	"postgres":  "SELECT version()",
+	"mysql":     "SELECT version()",
+	"sqlite3":   "SELECT sqlite_version()",
+	"mssql":     "SELECT @@VERSION",
+	"oci8":      "SELECT banner FROM v$version WHERE rownum = 1",
+	"snowflake": "SELECT current_version()",
+}
+
+// ProbeResult reports the outcome of testing a connection spec.
+type ProbeResult struct {
+	Version string
+	Latency time.Duration
+}
+
+// TestConnection opens a connection for driver/params, runs the
+// driver-appropriate probe query, and reports the server version and
+// round-trip latency. The connection is always closed afterward and is
+// never added to the persistent pool, since this is meant for validating
+// connection details before they are saved.
+func TestConnection(driver string, params map[string]interface{}) (*ProbeResult, error) {
+	internal, ok := Drivers[driver]
+	if !ok {
+		return nil, ErrUnknownDriver
+	}
+
+	start := time.Now()
+
+	db, err := Connect(driver, params)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	probe, ok := probeQueries[internal]
+	if !ok {
+		probe = "SELECT 1"
+	}
+
+	if _, err := db.Exec(probe); err != nil {
+		return nil, err
+	}
+
+	result := &ProbeResult{Latency: time.Since(start)}
+
+	if q, ok := versionQueries[internal]; ok {
+		// Version lookup is best-effort; a failure here shouldn't fail the
+		// connection test itself.
+		db.Get(&result.Version, q)
+	}
+
+	return result, nil
+}
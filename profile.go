@@ -0,0 +1,256 @@
+package sqlagent
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Default guardrails applied to profiles that do not override them.
+var (
+	DefaultTimeout        time.Duration
+	DefaultMaxRows        int
+	DefaultMaxConcurrency int
+	DefaultConnectTimeout time.Duration
+
+	// DefaultAcquireTimeout is the acquire timeout applied to profiles that
+	// do not override it. Zero means Acquire blocks indefinitely, preserving
+	// the original behavior.
+	DefaultAcquireTimeout time.Duration
+
+	// DefaultLintMode is the Lint mode applied to profiles that do not
+	// override it: "" (disabled), "warn", or "block". See Profile.LintMode.
+	DefaultLintMode string
+)
+
+// ErrPoolExhausted is returned by Acquire (and therefore ExecuteProfile)
+// when no concurrency slot freed up within the profile's acquire timeout.
+var ErrPoolExhausted = errors.New("sqlagent: pool exhausted: no connection slot available within acquire timeout")
+
+// PoolWaitObserver, when set, is called after every Acquire with how long
+// the caller waited for a concurrency slot and whether it timed out, so a
+// host binary can export wait-time metrics (e.g. expvar counters an
+// operator can use to size MaxConcurrency from data). It mirrors the
+// RouteObserver/ShadowObserver hook pattern. A nil observer disables
+// reporting.
+var PoolWaitObserver func(profile string, waited time.Duration, timedOut bool)
+
+func reportPoolWait(profile string, waited time.Duration, timedOut bool) {
+	if PoolWaitObserver != nil {
+		PoolWaitObserver(profile, waited, timedOut)
+	}
+}
+
+// Profile defines the connection parameters and execution guardrails for a
+// named database target. A Snowflake warehouse and a tiny OLTP primary
+// generally need very different timeout, row limit, and concurrency
+// settings, so profiles let each one override the global defaults.
+type Profile struct {
+	// Name identifies the profile for diagnostics (e.g. PoolWaitObserver),
+	// set by RegisterProfile's caller. It plays no role in lookups:
+	// RegisterProfile/GetProfile key off the tenant+name pair passed to
+	// them directly.
+	Name string
+
+	Driver     string
+	Connection map[string]interface{}
+
+	// Timeout overrides DefaultTimeout for queries run against this profile.
+	// Zero means fall back to the default.
+	Timeout time.Duration
+
+	// MaxRows overrides DefaultMaxRows. Zero means fall back to the default.
+	MaxRows int
+
+	// MaxConcurrency overrides DefaultMaxConcurrency. Zero means fall back
+	// to the default.
+	MaxConcurrency int
+
+	// ConnectTimeout overrides DefaultConnectTimeout, bounding how long
+	// opening a new pooled connection may take. Zero means fall back to
+	// the default.
+	ConnectTimeout time.Duration
+
+	// AcquireTimeout overrides DefaultAcquireTimeout, bounding how long
+	// Acquire waits for a concurrency slot before returning
+	// ErrPoolExhausted. Zero means fall back to the default, and a default
+	// of zero means wait indefinitely.
+	AcquireTimeout time.Duration
+
+	// LintMode overrides DefaultLintMode, controlling what Lint's warnings
+	// do for queries run against this profile: "" falls back to the
+	// default, "warn" surfaces them without affecting execution, and
+	// "block" rejects the query instead of running it.
+	LintMode string
+
+	// Shadow, when set, also runs a sample of this profile's queries
+	// against a second backend for migration validation; see ShadowConfig
+	// and RunShadow. Nil disables shadowing.
+	Shadow *ShadowConfig
+
+	// MaintenanceWindows declares spans of time during which this profile
+	// rejects some or all queries; see MaintenanceWindow and
+	// Profile.CheckMaintenance. A nil slice means the profile is never in
+	// maintenance.
+	MaintenanceWindows []MaintenanceWindow
+
+	once sync.Once
+	sem  chan struct{}
+}
+
+// EffectiveTimeout returns the profile's timeout, falling back to DefaultTimeout.
+func (p *Profile) EffectiveTimeout() time.Duration {
+	if p != nil && p.Timeout > 0 {
+		return p.Timeout
+	}
+	return DefaultTimeout
+}
+
+// EffectiveMaxRows returns the profile's row limit, falling back to DefaultMaxRows.
+func (p *Profile) EffectiveMaxRows() int {
+	if p != nil && p.MaxRows > 0 {
+		return p.MaxRows
+	}
+	return DefaultMaxRows
+}
+
+// EffectiveMaxConcurrency returns the profile's concurrency limit, falling
+// back to DefaultMaxConcurrency.
+func (p *Profile) EffectiveMaxConcurrency() int {
+	if p != nil && p.MaxConcurrency > 0 {
+		return p.MaxConcurrency
+	}
+	return DefaultMaxConcurrency
+}
+
+// EffectiveConnectTimeout returns the profile's connect timeout, falling
+// back to DefaultConnectTimeout.
+func (p *Profile) EffectiveConnectTimeout() time.Duration {
+	if p != nil && p.ConnectTimeout > 0 {
+		return p.ConnectTimeout
+	}
+	return DefaultConnectTimeout
+}
+
+// EffectiveAcquireTimeout returns the profile's acquire timeout, falling
+// back to DefaultAcquireTimeout.
+func (p *Profile) EffectiveAcquireTimeout() time.Duration {
+	if p != nil && p.AcquireTimeout > 0 {
+		return p.AcquireTimeout
+	}
+	return DefaultAcquireTimeout
+}
+
+// EffectiveLintMode returns the profile's lint mode, falling back to
+// DefaultLintMode.
+func (p *Profile) EffectiveLintMode() string {
+	if p != nil && p.LintMode != "" {
+		return p.LintMode
+	}
+	return DefaultLintMode
+}
+
+// Acquire blocks until a concurrency slot is available for the profile, up
+// to its EffectiveAcquireTimeout, returning ErrPoolExhausted if none frees
+// up in time. It is a no-op when no profile is given or no concurrency
+// limit applies. Every call reports how long it waited via
+// PoolWaitObserver, whether or not it timed out.
+func (p *Profile) Acquire() error {
+	if p == nil {
+		return nil
+	}
+
+	n := p.EffectiveMaxConcurrency()
+	if n <= 0 {
+		return nil
+	}
+
+	p.once.Do(func() {
+		p.sem = make(chan struct{}, n)
+	})
+
+	timeout := p.EffectiveAcquireTimeout()
+	start := time.Now()
+
+	if timeout <= 0 {
+		p.sem <- struct{}{}
+		reportPoolWait(p.Name, time.Since(start), false)
+		return nil
+	}
+
+	select {
+	case p.sem <- struct{}{}:
+		reportPoolWait(p.Name, time.Since(start), false)
+		return nil
+	case <-time.After(timeout):
+		reportPoolWait(p.Name, time.Since(start), true)
+		return ErrPoolExhausted
+	}
+}
+
+// Release frees a concurrency slot previously obtained with Acquire.
+func (p *Profile) Release() {
+	if p == nil || p.sem == nil {
+		return
+	}
+
+	select {
+	case <-p.sem:
+	default:
+	}
+}
+
+// DefaultTenant is the namespace used when a deployment does not derive a
+// tenant from auth, preserving single-tenant behavior.
+const DefaultTenant = ""
+
+var (
+	profiles      = make(map[string]map[string]*Profile)
+	profilesMutex sync.RWMutex
+)
+
+// RegisterProfile adds or replaces a named connection profile within a
+// tenant's namespace. Profiles in one tenant are never visible to another,
+// so one agent deployment can safely serve multiple teams.
+func RegisterProfile(tenant, name string, p *Profile) {
+	profilesMutex.Lock()
+	defer profilesMutex.Unlock()
+
+	ns, ok := profiles[tenant]
+	if !ok {
+		ns = make(map[string]*Profile)
+		profiles[tenant] = ns
+	}
+
+	ns[name] = p
+}
+
+// GetProfile returns the named profile within a tenant's namespace and
+// whether it was found.
+func GetProfile(tenant, name string) (*Profile, bool) {
+	profilesMutex.RLock()
+	defer profilesMutex.RUnlock()
+
+	ns, ok := profiles[tenant]
+	if !ok {
+		return nil, false
+	}
+
+	p, ok := ns[name]
+	return p, ok
+}
+
+// ListProfiles returns every registered profile name within a tenant's
+// namespace, for admin tooling (GET /ui) that needs to enumerate pools
+// rather than look one up by name.
+func ListProfiles(tenant string) map[string]*Profile {
+	profilesMutex.RLock()
+	defer profilesMutex.RUnlock()
+
+	out := make(map[string]*Profile, len(profiles[tenant]))
+	for name, p := range profiles[tenant] {
+		out[name] = p
+	}
+
+	return out
+}
@@ -0,0 +1,161 @@
+package sqlagent
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RouteObserver, when set, is called with the host chosen by
+// resolveLatencyRoutedParams for a connection, so callers can expose it as
+// a metric (e.g. an expvar.Map counting connections per target). A nil
+// value, the default, disables the callback.
+var RouteObserver func(host string)
+
+// latencyProbeInterval is how often a known replica host's connect latency
+// is re-measured in the background.
+var latencyProbeInterval = 30 * time.Second
+
+// latencyProbeTimeout bounds how long a single probe dial may take before
+// the host is considered unhealthy for that round.
+var latencyProbeTimeout = 2 * time.Second
+
+// hostHealth is the most recent latency probe result for one host:addr.
+type hostHealth struct {
+	latency time.Duration
+	healthy bool
+}
+
+var (
+	hostHealthMu     sync.RWMutex
+	hostHealthByAddr = make(map[string]hostHealth)
+	probedAddrs      = make(map[string]bool)
+)
+
+// ensureProbing starts a background probe loop for addr the first time it's
+// seen, and blocks for the first measurement so routing doesn't pick blind
+// before any latency data exists for a newly-seen replica.
+func ensureProbing(addr string) {
+	hostHealthMu.Lock()
+	if probedAddrs[addr] {
+		hostHealthMu.Unlock()
+		return
+	}
+	probedAddrs[addr] = true
+	hostHealthMu.Unlock()
+
+	probeHost(addr)
+
+	go func() {
+		for range time.Tick(latencyProbeInterval) {
+			probeHost(addr)
+		}
+	}()
+}
+
+// probeHost measures addr's TCP connect latency as a proxy for round-trip
+// time to the database host, since the driver-level protocol handshake
+// isn't available before a dialect/credentials are chosen.
+func probeHost(addr string) {
+	start := time.Now()
+
+	conn, err := net.DialTimeout("tcp", addr, latencyProbeTimeout)
+
+	h := hostHealth{}
+
+	if err == nil {
+		h.healthy = true
+		h.latency = time.Since(start)
+		conn.Close()
+	}
+
+	hostHealthMu.Lock()
+	hostHealthByAddr[addr] = h
+	hostHealthMu.Unlock()
+}
+
+// resolveLatencyRoutedParams rewrites a `hosts` connection parameter — a
+// list of {"host": ..., "port": ..., "region": ...} read replica
+// candidates — into a single `host`/`port`, chosen as the healthy
+// candidate with the lowest measured TCP connect latency. Each candidate's
+// latency is tracked on its own background probe loop once first seen, so
+// routing reflects a continuously refreshed view of the replica set rather
+// than a one-off measurement per query. Params without a `hosts` list are
+// returned unchanged.
+func resolveLatencyRoutedParams(params map[string]interface{}) (map[string]interface{}, error) {
+	raw, ok := params["hosts"].([]interface{})
+	if !ok {
+		return params, nil
+	}
+
+	type candidate struct {
+		host string
+		port interface{}
+		addr string
+	}
+
+	var candidates []candidate
+
+	for _, r := range raw {
+		m, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		host, _ := m["host"].(string)
+		if host == "" {
+			continue
+		}
+
+		port := fmt.Sprint(m["port"])
+		if port == "" || port == "<nil>" {
+			continue
+		}
+
+		candidates = append(candidates, candidate{host: host, port: m["port"], addr: net.JoinHostPort(host, port)})
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("sqlagent: \"hosts\" must be a non-empty list of {\"host\": ..., \"port\": ...} objects")
+	}
+
+	for _, c := range candidates {
+		ensureProbing(c.addr)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		hi, hj := healthOf(candidates[i].addr), healthOf(candidates[j].addr)
+
+		if hi.healthy != hj.healthy {
+			return hi.healthy
+		}
+
+		return hi.latency < hj.latency
+	})
+
+	chosen := candidates[0]
+
+	resolved := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		resolved[k] = v
+	}
+
+	delete(resolved, "hosts")
+	resolved["host"] = chosen.host
+	resolved["port"] = chosen.port
+
+	if RouteObserver != nil {
+		RouteObserver(chosen.host)
+	}
+
+	return resolved, nil
+}
+
+func healthOf(addr string) hostHealth {
+	hostHealthMu.RLock()
+	defer hostHealthMu.RUnlock()
+
+	return hostHealthByAddr[addr]
+}
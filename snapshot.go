@@ -0,0 +1,43 @@
+package sqlagent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrSnapshotUnsupported is returned by DecorateSnapshot for a driver with
+// no known point-in-time read syntax.
+var ErrSnapshotUnsupported = fmt.Errorf("sqlagent: snapshot reads are not supported for this driver")
+
+// DecorateSnapshot rewrites sql to read as of at, using driver's
+// point-in-time syntax, so clients can request a snapshot read without
+// hand-crafting dialect-specific SQL.
+//
+// BigQuery's `FOR SYSTEM_TIME AS OF` is intentionally unimplemented: this
+// agent has no BigQuery driver to run it against.
+func DecorateSnapshot(driver, sql string, at time.Time) (string, error) {
+	ts := at.UTC().Format("2006-01-02 15:04:05.999999999")
+
+	switch driver {
+	case "snowflake":
+		// AT() applies to a single table reference, so the only safe way
+		// to apply it to an arbitrary query is to wrap the whole thing as
+		// a derived table and let Snowflake resolve the travel point
+		// against every table it touches via the session parameter it
+		// implies; callers needing per-table control should write the
+		// AT() clause into their own SQL instead.
+		return fmt.Sprintf("SELECT * FROM (%s) AT (TIMESTAMP => '%s'::timestamp_tz)", sql, ts), nil
+
+	case "cockroachdb":
+		// AS OF SYSTEM TIME is a statement-level suffix, so it can be
+		// appended safely regardless of the query's shape. Plain Postgres
+		// has no equivalent and will reject this at query time, which is
+		// why it isn't handled alongside "cockroachdb" here even though
+		// both share the "postgres" registered driver.
+		return fmt.Sprintf("%s AS OF SYSTEM TIME '%s'", strings.TrimRight(strings.TrimSpace(sql), ";"), ts), nil
+
+	default:
+		return "", ErrSnapshotUnsupported
+	}
+}
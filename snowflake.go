@@ -0,0 +1,91 @@
+package sqlagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// snowflakeSemiStructuredTypes are the Snowflake column type names whose
+// values arrive as JSON text and should be decoded into native structures
+// rather than returned as escaped strings.
+var snowflakeSemiStructuredTypes = map[string]bool{
+	"VARIANT": true,
+	"OBJECT":  true,
+	"ARRAY":   true,
+}
+
+// encodeVariantParams JSON-encodes any map or slice parameter values so they
+// can be bound as Snowflake VARIANT/OBJECT/ARRAY parameters, typically via
+// `PARSE_JSON(:param)` in the query text. The driver has no native way to
+// bind a Go map or slice directly.
+func encodeVariantParams(params map[string]interface{}) map[string]interface{} {
+	if params == nil {
+		return nil
+	}
+
+	encoded := make(map[string]interface{}, len(params))
+
+	for k, v := range params {
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			if b, err := json.Marshal(v); err == nil {
+				v = string(b)
+			}
+		}
+
+		encoded[k] = v
+	}
+
+	return encoded
+}
+
+// snowflakeQueryIDPattern matches a Snowflake query ID (a UUID), guarding
+// QueryStatus against interpolating arbitrary input into SQL text.
+var snowflakeQueryIDPattern = regexp.MustCompile(`^[0-9a-fA-F-]{8,64}$`)
+
+// QueryStatus looks up the execution status of a previously run Snowflake
+// query by its ID (see Iterator.QueryID), so a caller that resumed polling
+// after losing the original response can find out what happened to it.
+//
+// This only reports status, not the query's result rows: the vendored
+// gosnowflake driver doesn't expose the lower-level result-batch-fetch API
+// a true "resume a dropped fetch" feature would need, so a caller that
+// needs the actual rows has to re-run the query.
+func QueryStatus(db *sqlx.DB, queryID string) (map[string]interface{}, error) {
+	if !snowflakeQueryIDPattern.MatchString(queryID) {
+		return nil, fmt.Errorf("sqlagent: invalid Snowflake query ID: %q", queryID)
+	}
+
+	var raw string
+
+	query := fmt.Sprintf("select system$get_query_status('%s')", queryID)
+	if err := db.Get(&raw, query); err != nil {
+		return nil, err
+	}
+
+	var status map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &status); err != nil {
+		return nil, fmt.Errorf("sqlagent: decoding query status: %s", err)
+	}
+
+	return status, nil
+}
+
+// decodeSemiStructured unmarshals the VARIANT/OBJECT/ARRAY columns named in
+// cols from their raw JSON text into native Go structures, in place.
+func decodeSemiStructured(r Record, cols map[string]bool) {
+	for col := range cols {
+		s, ok := r[col].(string)
+		if !ok {
+			continue
+		}
+
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(s), &decoded); err == nil {
+			r[col] = decoded
+		}
+	}
+}
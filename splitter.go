@@ -0,0 +1,141 @@
+package sqlagent
+
+import (
+	"regexp"
+	"strings"
+)
+
+// mssqlGoSeparator matches a standalone `GO` batch separator line, the
+// convention T-SQL tooling (sqlcmd, SSMS) uses instead of semicolons.
+var mssqlGoSeparator = regexp.MustCompile(`(?im)^[ \t]*GO[ \t]*$`)
+
+// SplitStatements splits sql into individual statements using
+// driver-appropriate rules: MSSQL scripts are split on a standalone `GO`
+// batch separator line, while every other driver splits on semicolons,
+// correctly skipping semicolons inside quoted strings, quoted identifiers,
+// comments, and (for Postgres) `$tag$`-delimited function bodies.
+func SplitStatements(driver, sql string) []string {
+	if driver == "mssql" {
+		return trimNonEmpty(mssqlGoSeparator.Split(sql, -1))
+	}
+
+	return trimNonEmpty(splitOnSemicolons(sql))
+}
+
+func trimNonEmpty(parts []string) []string {
+	out := make([]string, 0, len(parts))
+
+	for _, p := range parts {
+		if t := strings.TrimSpace(p); t != "" {
+			out = append(out, t)
+		}
+	}
+
+	return out
+}
+
+// splitOnSemicolons splits sql on top-level semicolons, treating anything
+// inside single/double quotes, a `--`/`/* */` comment, or a `$tag$...$tag$`
+// dollar-quoted body as part of the current statement rather than a
+// delimiter.
+func splitOnSemicolons(sql string) []string {
+	var (
+		stmts          []string
+		start          int
+		inSingle       bool
+		inDouble       bool
+		inLineComment  bool
+		inBlockComment bool
+		dollarTag      string
+	)
+
+	runes := []rune(sql)
+
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+
+		switch {
+		case inLineComment:
+			if c == '\n' {
+				inLineComment = false
+			}
+			continue
+
+		case inBlockComment:
+			if c == '*' && i+1 < len(runes) && runes[i+1] == '/' {
+				inBlockComment = false
+				i++
+			}
+			continue
+
+		case dollarTag != "":
+			if strings.HasPrefix(string(runes[i:]), dollarTag) {
+				i += len(dollarTag) - 1
+				dollarTag = ""
+			}
+			continue
+
+		case inSingle:
+			if c == '\'' {
+				inSingle = false
+			}
+			continue
+
+		case inDouble:
+			if c == '"' {
+				inDouble = false
+			}
+			continue
+		}
+
+		switch c {
+		case '\'':
+			inSingle = true
+		case '"':
+			inDouble = true
+		case '-':
+			if i+1 < len(runes) && runes[i+1] == '-' {
+				inLineComment = true
+			}
+		case '/':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				inBlockComment = true
+			}
+		case '$':
+			if tag, end := matchDollarTag(runes, i); tag != "" {
+				dollarTag = tag
+				i = end
+			}
+		case ';':
+			stmts = append(stmts, string(runes[start:i]))
+			start = i + 1
+		}
+	}
+
+	if start < len(runes) {
+		stmts = append(stmts, string(runes[start:]))
+	}
+
+	return stmts
+}
+
+// matchDollarTag recognizes a Postgres dollar-quote opening tag (`$$` or
+// `$tag$`) starting at i and returns the tag text, including both `$`
+// delimiters, and the index of its final character.
+func matchDollarTag(runes []rune, i int) (string, int) {
+	j := i + 1
+
+	for j < len(runes) && isIdentRune(runes[j]) {
+		j++
+	}
+
+	if j >= len(runes) || runes[j] != '$' {
+		return "", i
+	}
+
+	return string(runes[i : j+1]), j
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
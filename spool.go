@@ -0,0 +1,222 @@
+package sqlagent
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+func init() {
+	// Register the concrete types database/sql (via sqlx's MapScan) puts
+	// into a Record's interface{} values, so gob can encode/decode them
+	// when a RowBuffer spills to disk.
+	gob.Register(int64(0))
+	gob.Register(float64(0))
+	gob.Register(true)
+	gob.Register("")
+	gob.Register(time.Time{})
+}
+
+// MaxBufferedBytes caps how much of a buffered (non-streaming) result
+// RowBuffer keeps in memory before spilling the remainder to a temporary
+// file, so one large query cannot OOM-kill the process.
+var MaxBufferedBytes int64 = 64 << 20 // 64MiB
+
+// RowBuffer accumulates records for a non-streaming response, estimating
+// their in-memory footprint as they arrive and spilling to a temp file once
+// MaxBufferedBytes is exceeded.
+type RowBuffer struct {
+	mem    []Record
+	memLen int64
+
+	file *os.File
+	bw   *bufio.Writer
+	enc  *gob.Encoder
+	n    int
+}
+
+// Add appends a record to the buffer, spilling everything accumulated so
+// far (and all records added after) to disk the first time the estimated
+// in-memory size exceeds MaxBufferedBytes.
+func (b *RowBuffer) Add(r Record) error {
+	b.n++
+
+	if b.file != nil {
+		return b.enc.Encode(r)
+	}
+
+	b.mem = append(b.mem, r)
+	b.memLen += estimateRecordSize(r)
+
+	if b.memLen <= MaxBufferedBytes {
+		return nil
+	}
+
+	f, err := ioutil.TempFile("", "sqlagent-spill-")
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(f)
+	enc := gob.NewEncoder(bw)
+
+	for _, spilled := range b.mem {
+		if err := enc.Encode(spilled); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+	}
+
+	b.file, b.bw, b.enc = f, bw, enc
+	b.mem = nil
+
+	return nil
+}
+
+// Len returns the number of records added so far.
+func (b *RowBuffer) Len() int {
+	return b.n
+}
+
+// Each calls fn for every buffered record in the order they were added,
+// reading from memory first and then the spill file, if one was created.
+func (b *RowBuffer) Each(fn func(Record) error) error {
+	for _, r := range b.mem {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+
+	if b.file == nil {
+		return nil
+	}
+
+	if err := b.bw.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	dec := gob.NewDecoder(bufio.NewReader(b.file))
+
+	for {
+		var r Record
+
+		if err := dec.Decode(&r); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+}
+
+// Close releases the spill file, if one was created.
+func (b *RowBuffer) Close() error {
+	if b.file == nil {
+		return nil
+	}
+
+	name := b.file.Name()
+	b.file.Close()
+	return os.Remove(name)
+}
+
+// estimateRecordSize approximates a record's in-memory footprint from its
+// keys and values, which is precise enough to decide when to spill without
+// the cost of an exact accounting.
+func estimateRecordSize(r Record) int64 {
+	var n int64
+
+	for k, v := range r {
+		n += int64(len(k))
+
+		switch x := v.(type) {
+		case string:
+			n += int64(len(x))
+		case []byte:
+			n += int64(len(x))
+		default:
+			n += 8
+		}
+	}
+
+	return n
+}
+
+// Buffer fully materializes i into a RowBuffer, spilling to disk once
+// MaxBufferedBytes is exceeded. Use this for non-streaming response modes,
+// where the full result must be read (and any error surfaced cleanly)
+// before a single byte is written, instead of streaming a response that may
+// have to be abandoned partway through.
+func Buffer(i *Iterator) (*RowBuffer, error) {
+	b := &RowBuffer{}
+	r := make(Record)
+
+	for i.Next() {
+		if err := i.Scan(r); err != nil {
+			b.Close()
+			return nil, err
+		}
+
+		cp := make(Record, len(r))
+		for k, v := range r {
+			cp[k] = v
+		}
+
+		if err := b.Add(cp); err != nil {
+			b.Close()
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// BufferSorted behaves like Buffer, but first sorts every record by
+// sortKey (see sortDeterministic) before populating the returned
+// RowBuffer, for the opt-in deterministic response mode. Producing a
+// stable order requires holding the full result set in memory at once to
+// sort it, unlike Buffer's incremental spill-as-you-go accumulation, so
+// this costs more memory for a large result than plain buffering does.
+func BufferSorted(i *Iterator, sortKey string) (*RowBuffer, error) {
+	var all []Record
+
+	r := make(Record)
+
+	for i.Next() {
+		if err := i.Scan(r); err != nil {
+			return nil, err
+		}
+
+		cp := make(Record, len(r))
+		for k, v := range r {
+			cp[k] = v
+		}
+
+		all = append(all, cp)
+	}
+
+	sortDeterministic(i.Cols, all, sortKey)
+
+	b := &RowBuffer{}
+
+	for _, rec := range all {
+		if err := b.Add(rec); err != nil {
+			b.Close()
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
@@ -0,0 +1,226 @@
+package sqlagent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TransformArg is one operand to a Transform: either a reference to an
+// existing column (Col) or a literal value (Lit). Exactly one should be
+// set; if both are empty, it resolves to the empty string.
+type TransformArg struct {
+	Col string `json:"col,omitempty"`
+	Lit string `json:"lit,omitempty"`
+}
+
+// resolve returns the value this arg contributes for record r: the
+// column's current value if Col is set, otherwise the literal text.
+func (a TransformArg) resolve(r Record) interface{} {
+	if a.Col != "" {
+		return r[a.Col]
+	}
+
+	return a.Lit
+}
+
+// Transform describes one computed or renamed output column, evaluated
+// against a streamed Record. It is a deliberately small, fixed set of
+// operations rather than a general-purpose expression language: backends
+// whose dialect lacks a needed function, or whose caller lacks permission
+// to create a view, get a server-side escape hatch without the agent
+// having to embed a SQL-like parser and evaluator.
+//
+// Supported Op values:
+//
+//   - "rename": Args must have exactly one Col entry; the column is moved
+//     (not copied) to Output.
+//   - "cast": Args must have exactly one Col entry; Type names the target
+//     representation ("string", "int", "float", "bool", or "date"/
+//     "datetime"), converted with the same loose coercion rules as
+//     TypedParam uses for input binding, applied in the opposite
+//     direction.
+//   - "concat": every Arg (Col or Lit) is stringified and joined in
+//     order.
+//   - "date_trunc": Args must have exactly one Col entry holding a
+//     time.Time (or a value ScanRow/Scan already decoded to one); Type
+//     names the truncation unit ("year", "month", "day", "hour",
+//     "minute").
+//
+// A Transform whose Args don't match what its Op expects, or whose
+// referenced column is absent from the row, is silently skipped for that
+// row rather than aborting the whole result: a transform exists to add
+// information, and one bad row shouldn't take down the rest of a stream
+// that already started sending a 200.
+type Transform struct {
+	Output string         `json:"output"`
+	Op     string         `json:"op"`
+	Args   []TransformArg `json:"args,omitempty"`
+	Type   string         `json:"type,omitempty"`
+}
+
+// Transforms is an ordered list of Transform. They're applied in order, so
+// a later Transform may reference a column an earlier one produced or
+// renamed.
+type Transforms []Transform
+
+// Apply evaluates ts against r in place, returning r.
+func (ts Transforms) Apply(r Record) Record {
+	for _, t := range ts {
+		switch t.Op {
+		case "rename":
+			if col, ok := soleCol(t.Args); ok {
+				if v, ok := r[col]; ok {
+					delete(r, col)
+					r[t.Output] = v
+				}
+			}
+		case "cast":
+			if col, ok := soleCol(t.Args); ok {
+				if v, ok := r[col]; ok {
+					if cv, err := castValue(v, t.Type); err == nil {
+						r[t.Output] = cv
+					}
+				}
+			}
+		case "concat":
+			var b strings.Builder
+
+			for _, a := range t.Args {
+				b.WriteString(stringifyValue(a.resolve(r)))
+			}
+
+			r[t.Output] = b.String()
+		case "date_trunc":
+			if col, ok := soleCol(t.Args); ok {
+				if v, ok := r[col]; ok {
+					if tv, err := truncateDate(v, t.Type); err == nil {
+						r[t.Output] = tv
+					}
+				}
+			}
+		}
+	}
+
+	return r
+}
+
+// soleCol returns the single column name args refers to, for ops that
+// take exactly one Col argument.
+func soleCol(args []TransformArg) (string, bool) {
+	if len(args) != 1 || args[0].Col == "" {
+		return "", false
+	}
+
+	return args[0].Col, true
+}
+
+// castValue converts v, as scanned from the driver, to typ. Unlike
+// TypedParam.convert, which parses a request string into a bind value,
+// this goes the other way: it reformats a value the driver already
+// produced.
+func castValue(v interface{}, typ string) (interface{}, error) {
+	switch typ {
+	case "string":
+		return stringifyValue(v), nil
+	case "int":
+		switch x := v.(type) {
+		case int64:
+			return x, nil
+		case float64:
+			return int64(x), nil
+		case []byte:
+			return strconv.ParseInt(string(x), 10, 64)
+		case string:
+			return strconv.ParseInt(x, 10, 64)
+		}
+	case "float":
+		switch x := v.(type) {
+		case float64:
+			return x, nil
+		case int64:
+			return float64(x), nil
+		case []byte:
+			return strconv.ParseFloat(string(x), 64)
+		case string:
+			return strconv.ParseFloat(x, 64)
+		}
+	case "bool":
+		switch x := v.(type) {
+		case bool:
+			return x, nil
+		case []byte:
+			return strconv.ParseBool(string(x))
+		case string:
+			return strconv.ParseBool(x)
+		}
+	case "date", "datetime":
+		return asTime(v)
+	}
+
+	return nil, fmt.Errorf("sqlagent: cannot cast %T to %q", v, typ)
+}
+
+// truncateDate parses v as a time and truncates it to unit, which is one
+// of "year", "month", "day", "hour", or "minute".
+func truncateDate(v interface{}, unit string) (time.Time, error) {
+	t, err := asTime(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	switch unit {
+	case "year":
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location()), nil
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()), nil
+	case "day":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()), nil
+	case "hour":
+		return t.Truncate(time.Hour), nil
+	case "minute":
+		return t.Truncate(time.Minute), nil
+	default:
+		return time.Time{}, fmt.Errorf("sqlagent: unknown date_trunc unit %q", unit)
+	}
+}
+
+// asTime coerces a driver-scanned value into a time.Time.
+func asTime(v interface{}) (time.Time, error) {
+	switch x := v.(type) {
+	case time.Time:
+		return x, nil
+	case []byte:
+		return parseTimeString(string(x))
+	case string:
+		return parseTimeString(x)
+	default:
+		return time.Time{}, fmt.Errorf("sqlagent: cannot interpret %T as a date", v)
+	}
+}
+
+func parseTimeString(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("sqlagent: %q is not a recognized date/time format", s)
+}
+
+// stringifyValue formats v the same way the built-in CSV row encoder
+// does, so concat's output matches what a client would already see if it
+// requested the same column as text/csv.
+func stringifyValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,100 @@
+package sqlagent
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TypedParam is the shape a bind parameter value may take instead of a
+// bare JSON scalar, to disambiguate how its string Value should be
+// bound: {"value": "2024-01-01", "type": "date"}. Every other JSON shape
+// (a bare string, number, bool, null, or an object without both "value"
+// and "type" keys) binds exactly as it always has.
+//
+// Supported types:
+//
+//   - "date": Value is a "2006-01-02" date, converted to time.Time.
+//   - "datetime" / "timestamp": Value is an RFC3339 timestamp, converted
+//     to time.Time.
+//   - "decimal" / "numeric": Value is a base-10 number, converted to
+//     float64. float64 cannot represent every decimal exactly; callers
+//     needing exact precision should bind the raw string instead and let
+//     the database itself parse it.
+//   - "bytea" / "bytes": Value is standard base64, decoded to []byte.
+//   - "int" / "integer": Value is a base-10 integer, converted to int64.
+//   - "bool" / "boolean": Value is "true" or "false", converted to bool.
+type TypedParam struct {
+	Value string `json:"value"`
+	Type  string `json:"type"`
+}
+
+// resolveTypedParams converts every value in params that decodes as a
+// TypedParam to the Go type its Type names, leaving every other value
+// untouched. Without this, every param binds as whatever
+// encoding/json decoded it into (string, float64, bool, nil, or a nested
+// map/slice), which backends often reject or mis-coerce for dates, exact
+// decimals, and binary data.
+func resolveTypedParams(params map[string]interface{}) (map[string]interface{}, error) {
+	if params == nil {
+		return params, nil
+	}
+
+	resolved := make(map[string]interface{}, len(params))
+
+	for k, v := range params {
+		hint, ok := asTypedParam(v)
+		if !ok {
+			resolved[k] = v
+			continue
+		}
+
+		converted, err := hint.convert()
+		if err != nil {
+			return nil, fmt.Errorf("sqlagent: param %q: %s", k, err)
+		}
+
+		resolved[k] = converted
+	}
+
+	return resolved, nil
+}
+
+// asTypedParam reports whether v is a decoded JSON object shaped like a
+// TypedParam, i.e. map[string]interface{}{"value": ..., "type": ...} as
+// produced by encoding/json for a request body's params.
+func asTypedParam(v interface{}) (TypedParam, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return TypedParam{}, false
+	}
+
+	value, hasValue := m["value"].(string)
+	typ, hasType := m["type"].(string)
+
+	if !hasValue || !hasType {
+		return TypedParam{}, false
+	}
+
+	return TypedParam{Value: value, Type: typ}, true
+}
+
+func (t TypedParam) convert() (interface{}, error) {
+	switch t.Type {
+	case "date":
+		return time.Parse("2006-01-02", t.Value)
+	case "datetime", "timestamp":
+		return time.Parse(time.RFC3339, t.Value)
+	case "decimal", "numeric":
+		return strconv.ParseFloat(t.Value, 64)
+	case "bytea", "bytes":
+		return base64.StdEncoding.DecodeString(t.Value)
+	case "int", "integer":
+		return strconv.ParseInt(t.Value, 10, 64)
+	case "bool", "boolean":
+		return strconv.ParseBool(t.Value)
+	default:
+		return nil, fmt.Errorf("unknown type %q", t.Type)
+	}
+}
@@ -0,0 +1,146 @@
+package sqlagent
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// nullTime is the Scan destination typedScanDest uses for TIME/DATE/
+// DATETIME/TIMESTAMP columns. database/sql didn't add sql.NullTime until
+// Go 1.13, which postdates the Go version this project targets, so this
+// reimplements the same idea using asTime's existing []byte/string/
+// time.Time coercion.
+type nullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+func (n *nullTime) Scan(value interface{}) error {
+	if value == nil {
+		n.Time, n.Valid = time.Time{}, false
+		return nil
+	}
+
+	t, err := asTime(value)
+	if err != nil {
+		return err
+	}
+
+	n.Time, n.Valid = t, true
+	return nil
+}
+
+// columnScanKind classifies a column's driver-reported type into the kind
+// of Scan destination typedScanDest should use for it: "int", "float",
+// "bool", "time", "bytes", or "string" (the default, covering VARCHAR/TEXT/
+// CLOB and anything unrecognized). Matching is by substring over
+// DatabaseTypeName rather than an exact per-driver table, since drivers
+// name types inconsistently (MySQL's "VARCHAR" vs. Oracle's "VARCHAR2" vs.
+// Snowflake's "TEXT"); it's a best-effort heuristic across dialects, not a
+// guarantee for exotic or user-defined types, in the same spirit as Lint
+// and Analyze.
+//
+// NUMBER/DECIMAL/NUMERIC (Oracle and standard SQL's catch-all exact-numeric
+// types) are ambiguous by name alone - they're used for both integers and
+// fixed-point decimals - so this only classifies them as "int" when the
+// driver's DecimalSize reports a zero scale, and otherwise falls back to
+// "string" (today's behavior) rather than risk silently truncating a
+// decimal value to an integer.
+func columnScanKind(t *sql.ColumnType) string {
+	name := strings.ToUpper(t.DatabaseTypeName())
+
+	switch {
+	case strings.Contains(name, "BOOL") || name == "BIT":
+		return "bool"
+	case strings.Contains(name, "VARIANT") || strings.Contains(name, "OBJECT") || strings.Contains(name, "ARRAY"):
+		// Snowflake semi-structured columns arrive as JSON text and are
+		// decoded separately by decodeSemiStructured; they must stay
+		// strings here.
+		return "string"
+	case strings.Contains(name, "TIME") || strings.Contains(name, "DATE"):
+		return "time"
+	case strings.Contains(name, "BLOB") || strings.Contains(name, "BINARY") || strings.Contains(name, "BYTEA") || strings.Contains(name, "RAW") || strings.Contains(name, "IMAGE"):
+		return "bytes"
+	case strings.Contains(name, "NUMBER") || strings.Contains(name, "DECIMAL") || strings.Contains(name, "NUMERIC"):
+		if _, scale, ok := t.DecimalSize(); ok && scale == 0 {
+			return "int"
+		}
+		return "string"
+	case strings.Contains(name, "INT") || name == "FIXED" || name == "SERIAL":
+		return "int"
+	case strings.Contains(name, "FLOAT") || strings.Contains(name, "DOUBLE") || strings.Contains(name, "REAL") || strings.Contains(name, "MONEY"):
+		return "float"
+	default:
+		return "string"
+	}
+}
+
+// typedScanDest returns a fresh Scan destination of the Go type kind
+// names.
+func typedScanDest(kind string) interface{} {
+	switch kind {
+	case "int":
+		return new(sql.NullInt64)
+	case "float":
+		return new(sql.NullFloat64)
+	case "bool":
+		return new(sql.NullBool)
+	case "time":
+		return new(nullTime)
+	case "bytes":
+		return new(sql.RawBytes)
+	default:
+		return new(sql.NullString)
+	}
+}
+
+// typedScanValue unwraps dest (as produced by typedScanDest for the same
+// kind) into the plain Go value - or nil for a SQL NULL - that ends up in
+// the Record.
+func typedScanValue(kind string, dest interface{}) interface{} {
+	switch kind {
+	case "int":
+		v := dest.(*sql.NullInt64)
+		if !v.Valid {
+			return nil
+		}
+		return v.Int64
+	case "float":
+		v := dest.(*sql.NullFloat64)
+		if !v.Valid {
+			return nil
+		}
+		return v.Float64
+	case "bool":
+		v := dest.(*sql.NullBool)
+		if !v.Valid {
+			return nil
+		}
+		return v.Bool
+	case "time":
+		v := dest.(*nullTime)
+		if !v.Valid {
+			return nil
+		}
+		return v.Time
+	case "bytes":
+		v := dest.(*sql.RawBytes)
+		if *v == nil {
+			return nil
+		}
+
+		// RawBytes' backing array may be reused by the driver on the next
+		// Scan, so it has to be copied before this row's values outlive
+		// that call.
+		b := make([]byte, len(*v))
+		copy(b, *v)
+		return b
+	default:
+		v := dest.(*sql.NullString)
+		if !v.Valid {
+			return nil
+		}
+		return v.String
+	}
+}
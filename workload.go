@@ -0,0 +1,134 @@
+package sqlagent
+
+import "sync"
+
+// WorkloadGroup defines a named concurrency quota and scheduling priority
+// for queries, independent of the connection profile they run against, so
+// operators can stop a low-priority group (e.g. a nightly extract) from
+// starving a high-priority one (e.g. interactive dashboards) that shares
+// the same agent.
+type WorkloadGroup struct {
+	Name string
+
+	// MaxConcurrency caps how many queries from this group may run at
+	// once. Zero means the group is only bound by the scheduler's shared
+	// pool, if any.
+	MaxConcurrency int
+
+	// Priority is compared against other groups with outstanding demand
+	// whenever a shared-pool slot frees up; higher values are admitted
+	// first. Groups of equal priority are both eligible, but the order
+	// they're served in is not guaranteed to rotate evenly.
+	Priority int
+}
+
+// WorkloadScheduler admits queries from registered groups against an
+// optional shared pool of slots, preferring the highest-priority group
+// with outstanding demand whenever a slot is available.
+type WorkloadScheduler struct {
+	// slots caps total concurrent admissions across every group. Zero
+	// means the shared pool is unbounded and only each group's own
+	// MaxConcurrency applies.
+	slots int
+
+	mu      sync.Mutex
+	inUse   int
+	groups  map[string]*WorkloadGroup
+	inGroup map[string]int
+	waiting map[string][]chan struct{}
+}
+
+// NewWorkloadScheduler creates a scheduler whose shared pool admits at most
+// slots queries at once. A slots of zero leaves the pool unbounded, so only
+// each group's own MaxConcurrency is enforced.
+func NewWorkloadScheduler(slots int) *WorkloadScheduler {
+	return &WorkloadScheduler{
+		slots:   slots,
+		groups:  make(map[string]*WorkloadGroup),
+		inGroup: make(map[string]int),
+		waiting: make(map[string][]chan struct{}),
+	}
+}
+
+// Register adds or replaces a named workload group.
+func (s *WorkloadScheduler) Register(g *WorkloadGroup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.groups[g.Name] = g
+}
+
+// Acquire blocks until name is admitted, then returns a func that releases
+// its slot. Queries for a group that was never registered are admitted
+// immediately and uncounted, so an unconfigured group behaves as
+// unlimited rather than as a deadlock.
+func (s *WorkloadScheduler) Acquire(name string) func() {
+	s.mu.Lock()
+
+	if _, ok := s.groups[name]; !ok {
+		s.mu.Unlock()
+		return func() {}
+	}
+
+	ch := make(chan struct{})
+	s.waiting[name] = append(s.waiting[name], ch)
+	s.admitLocked()
+	s.mu.Unlock()
+
+	<-ch
+
+	return func() { s.release(name) }
+}
+
+// admitLocked grants slots to waiting groups, highest priority first,
+// until the shared pool (if bounded) or every waiting group's own cap is
+// exhausted. Callers must hold s.mu.
+func (s *WorkloadScheduler) admitLocked() {
+	for {
+		if s.slots > 0 && s.inUse >= s.slots {
+			return
+		}
+
+		var best *WorkloadGroup
+
+		for name, waiters := range s.waiting {
+			if len(waiters) == 0 {
+				continue
+			}
+
+			g := s.groups[name]
+			if g == nil {
+				continue
+			}
+
+			if g.MaxConcurrency > 0 && s.inGroup[name] >= g.MaxConcurrency {
+				continue
+			}
+
+			if best == nil || g.Priority > best.Priority {
+				best = g
+			}
+		}
+
+		if best == nil {
+			return
+		}
+
+		waiters := s.waiting[best.Name]
+		ch := waiters[0]
+		s.waiting[best.Name] = waiters[1:]
+
+		s.inUse++
+		s.inGroup[best.Name]++
+
+		close(ch)
+	}
+}
+
+func (s *WorkloadScheduler) release(name string) {
+	s.mu.Lock()
+	s.inUse--
+	s.inGroup[name]--
+	s.admitLocked()
+	s.mu.Unlock()
+}